@@ -1,28 +1,55 @@
 package batchcache
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/mmtbak/microlibrary/limiter"
 )
 
+// ErrClosed BatchCache 已停止.
+var ErrClosed = errors.New("batchcache: closed")
+
 type BatchCache[T any] struct {
-	maxItems         int           // 最大缓存项数
-	flushInterval    time.Duration // 刷新间隔
-	maxConcurrent    int           // 最大并发处理数 (0表示无限制)
-	buffer           []T           // 数据缓冲区
-	processor        func([]T)     // 批处理函数
-	stopChan         chan struct{} // 停止信号
+	maxItems         int               // 最大缓存项数
+	flushInterval    time.Duration     // 刷新间隔
+	maxConcurrent    int               // 最大并发处理数 (0表示无限制)
+	buffer           []T               // 数据缓冲区
+	processor        ProcessFunc[T]    // 批处理函数
+	retry            retryOption       // 重试配置
+	onFailure        FailureHandler[T] // 重试耗尽后的处理函数
+	stopChan         chan struct{}     // 停止信号
+	abortChan        chan struct{}     // Stop 超时信号, 放弃重试
+	startOnce        sync.Once
+	stopOnce         sync.Once
+	abortOnce        sync.Once
+	closed           bool // 已停止, Add 返回 ErrClosed
 	wg               sync.WaitGroup
 	mutex            sync.Mutex
 	flushTimer       *time.Timer
-	flushing         atomic.Bool    // 刷新状态标记
-	freshTriggerChan chan struct{}  // 触发通道(缓冲为1)
-	semaphore        chan struct{}  // 并发控制信号量
-	pendingWg        sync.WaitGroup // 等待处理中的任务
-	metrics          struct {       // 内置监控指标
+	flushing         atomic.Bool              // 刷新状态标记
+	freshTriggerChan chan struct{}            // 触发通道(缓冲为1)
+	semaphore        chan struct{}            // 并发控制信号量
+	inflight         map[uint64]chan struct{} // 处理中的批次, 处理完成时关闭并移除
+	batchSeq         uint64                   // 批次序号
+	maxPending       int                      // 待处理数据上限 (0表示无限制)
+	overflow         OverflowPolicy           // 达到上限时的处理策略
+	memoryLimiter    *limiter.MemoryLimiter   // 内存限制器
+	pending          int                      // 待处理数据项数
+	spaceChan        chan struct{}            // 释放空间时关闭, 唤醒等待的 Add
+	sizer            func(T) int              // 数据项大小计算函数
+	maxBytes         int                      // 缓冲区大小上限 (0表示无限制)
+	sizes            []int                    // 缓冲区每个数据项的大小, 设置 sizer 时记录
+	bufferBytes      int                      // 缓冲区数据的累计大小
+	metrics          struct {                 // 内置监控指标
 		queueLength int64
 		activeFlush int64
+		retries     int64
+		failedItems int64
+		dropped     int64
 	}
 }
 
@@ -31,6 +58,19 @@ func New[T any](
 	flushInterval time.Duration,
 	maxConcurrent int,
 	processor func([]T),
+) *BatchCache[T] {
+	return NewWithError(maxItems, flushInterval, maxConcurrent, func(batch []T) error {
+		processor(batch)
+		return nil
+	})
+}
+
+// NewWithError 处理函数返回 error, 配合 WithRetry 和 WithFailureHandler 处理失败的批次.
+func NewWithError[T any](
+	maxItems int,
+	flushInterval time.Duration,
+	maxConcurrent int,
+	processor ProcessFunc[T],
 ) *BatchCache[T] {
 	bc := &BatchCache[T]{
 		maxItems:         maxItems,
@@ -39,7 +79,10 @@ func New[T any](
 		buffer:           make([]T, 0, maxItems),
 		processor:        processor,
 		stopChan:         make(chan struct{}),
+		abortChan:        make(chan struct{}),
 		freshTriggerChan: make(chan struct{}, 1), // 缓冲为1的通知通道
+		spaceChan:        make(chan struct{}),
+		inflight:         make(map[uint64]chan struct{}),
 		flushTimer:       time.NewTimer(flushInterval),
 	}
 	bc.flushTimer.Stop()
@@ -54,32 +97,135 @@ func New[T any](
 	return bc
 }
 
-func (bc *BatchCache[T]) Start() {
-	bc.wg.Add(1)
-	go bc.run()
+// Start 启动后台刷新, 重复调用无效; ctx 结束时与调用 Stop 相同, 停止接收数据并处理剩余数据.
+func (bc *BatchCache[T]) Start(ctx context.Context) {
+	bc.startOnce.Do(func() {
+		bc.wg.Add(1)
+		go bc.run(ctx)
+	})
 }
 
-func (bc *BatchCache[T]) Stop() {
-	close(bc.stopChan)
-	bc.wg.Wait()
-	bc.pendingWg.Wait() // 等待所有处理完成
+// Stop 停止接收数据, 处理缓冲区剩余的数据并等待所有批次处理完成, 可以重复调用.
+// ctx 结束时不再等待并返回 ctx.Err(), 处理中的批次放弃剩余的重试.
+func (bc *BatchCache[T]) Stop(ctx context.Context) error {
+	bc.shutdown()
+	done := make(chan struct{})
+	go func() {
+		bc.wg.Wait()
+		// 未启动时由 Stop 处理剩余数据, 并等待所有处理完成
+		for _, d := range bc.safeFlush() {
+			<-d
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		bc.abortOnce.Do(func() { close(bc.abortChan) })
+		return ctx.Err()
+	}
 }
 
-func (bc *BatchCache[T]) Add(item T) {
+// Flush 同步处理当前缓冲区的数据, 等待调用前已经提交的所有批次处理完成或 ctx 结束.
+func (bc *BatchCache[T]) Flush(ctx context.Context) error {
+	for _, done := range bc.safeFlush() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// shutdown 停止接收数据并通知后台退出.
+func (bc *BatchCache[T]) shutdown() {
+	bc.stopOnce.Do(func() {
+		bc.mutex.Lock()
+		bc.closed = true
+		bc.mutex.Unlock()
+		close(bc.stopChan)
+	})
+}
+
+// Add 加入数据, 待处理数据达到上限时按 OverflowPolicy 处理.
+func (bc *BatchCache[T]) Add(item T) error {
+	return bc.AddContext(context.Background(), item)
+}
+
+// AddContext 加入数据, OverflowBlock 策略下阻塞直到有空间或 ctx 结束.
+func (bc *BatchCache[T]) AddContext(ctx context.Context, item T) error {
+	if bc.memoryLimiter != nil && !bc.memoryLimiter.CheckAvailable() {
+		atomic.AddInt64(&bc.metrics.dropped, 1)
+		return ErrMemoryLimit
+	}
+
 	bc.mutex.Lock()
+	if bc.closed {
+		bc.mutex.Unlock()
+		return ErrClosed
+	}
+	for bc.maxPending > 0 && bc.pending >= bc.maxPending {
+		switch bc.overflow {
+		case OverflowDropNewest:
+			bc.mutex.Unlock()
+			atomic.AddInt64(&bc.metrics.dropped, 1)
+			return nil
+		case OverflowError:
+			bc.mutex.Unlock()
+			atomic.AddInt64(&bc.metrics.dropped, 1)
+			return ErrBufferFull
+		case OverflowDropOldest:
+			if len(bc.buffer) == 0 {
+				// 数据都在处理中, 无法丢弃旧数据, 丢弃新数据
+				bc.mutex.Unlock()
+				atomic.AddInt64(&bc.metrics.dropped, 1)
+				return nil
+			}
+			var zero T
+			bc.buffer[0] = zero
+			bc.buffer = bc.buffer[1:]
+			if bc.sizer != nil {
+				bc.bufferBytes -= bc.sizes[0]
+				bc.sizes = bc.sizes[1:]
+			}
+			bc.pending--
+			atomic.AddInt64(&bc.metrics.dropped, 1)
+		default:
+			space := bc.spaceChan
+			bc.mutex.Unlock()
+			bc.trigger()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-bc.stopChan:
+				return ErrClosed
+			case <-space:
+			}
+			bc.mutex.Lock()
+			if bc.closed {
+				bc.mutex.Unlock()
+				return ErrClosed
+			}
+		}
+	}
 	bc.buffer = append(bc.buffer, item)
-	needFlush := len(bc.buffer) >= bc.maxItems
+	if bc.sizer != nil {
+		size := bc.sizer(item)
+		bc.sizes = append(bc.sizes, size)
+		bc.bufferBytes += size
+	}
+	bc.pending++
+	needFlush := len(bc.buffer) >= bc.maxItems || (bc.maxBytes > 0 && bc.bufferBytes >= bc.maxBytes)
 	atomic.StoreInt64(&bc.metrics.queueLength, int64(len(bc.buffer)))
 	bc.mutex.Unlock()
 
 	// 只有达到上限时才发送触发信号
 	if needFlush {
-		select {
-		case bc.freshTriggerChan <- struct{}{}: // 非阻塞发送
-		default:
-			// 通道已满说明已有待处理信号
-		}
+		bc.trigger()
 	}
+	return nil
 }
 
 func (bc *BatchCache[T]) QueueLength() int {
@@ -90,7 +236,7 @@ func (bc *BatchCache[T]) ActiveFlushes() int {
 	return int(atomic.LoadInt64(&bc.metrics.activeFlush))
 }
 
-func (bc *BatchCache[T]) run() {
+func (bc *BatchCache[T]) run(ctx context.Context) {
 	defer bc.wg.Done()
 	defer bc.flushTimer.Stop()
 
@@ -102,6 +248,11 @@ func (bc *BatchCache[T]) run() {
 			bc.safeFlush()
 			return
 
+		case <-ctx.Done():
+			bc.shutdown()
+			bc.safeFlush()
+			return
+
 		case <-bc.freshTriggerChan:
 			// 只有收到信号时才处理，确保不重复
 			if bc.flushing.CompareAndSwap(false, true) {
@@ -121,22 +272,35 @@ func (bc *BatchCache[T]) run() {
 	}
 }
 
-func (bc *BatchCache[T]) safeFlush() {
+// safeFlush 交换缓冲区并提交处理, 设置了 maxBytes 时按大小拆分为多个批次.
+// 返回此刻所有处理中批次(包括新提交的批次)的完成通知, 批次在交换缓冲区的同一个锁内登记, 不会遗漏.
+func (bc *BatchCache[T]) safeFlush() []<-chan struct{} {
 	bc.mutex.Lock()
-	if len(bc.buffer) == 0 {
-		bc.mutex.Unlock()
-		return
+	var batches [][]T
+	if len(bc.buffer) > 0 {
+		// 交换缓冲区
+		batches = splitBytes(bc.buffer, bc.sizes, bc.maxBytes)
+		bc.buffer = make([]T, 0, bc.maxItems)
+		bc.sizes, bc.bufferBytes = nil, 0
+		atomic.StoreInt64(&bc.metrics.queueLength, 0)
+	}
+	ids := make([]uint64, 0, len(batches))
+	for range batches {
+		bc.batchSeq++
+		bc.inflight[bc.batchSeq] = make(chan struct{})
+		ids = append(ids, bc.batchSeq)
+		atomic.AddInt64(&bc.metrics.activeFlush, 1)
+	}
+	dones := make([]<-chan struct{}, 0, len(bc.inflight))
+	for _, done := range bc.inflight {
+		dones = append(dones, done)
 	}
-
-	// 交换缓冲区
-	batch := bc.buffer
-	bc.buffer = make([]T, 0, bc.maxItems)
-	atomic.StoreInt64(&bc.metrics.queueLength, 0)
 	bc.mutex.Unlock()
 
-	if len(batch) > 0 {
-		bc.executeProcessor(batch)
+	for idx, batch := range batches {
+		bc.executeProcessor(ids[idx], batch)
 	}
+	return dones
 }
 
 func (bc *BatchCache[T]) safeFlushWithReset() {
@@ -144,14 +308,11 @@ func (bc *BatchCache[T]) safeFlushWithReset() {
 	bc.flushTimer.Reset(bc.flushInterval)
 }
 
-func (bc *BatchCache[T]) executeProcessor(batch []T) {
-	bc.pendingWg.Add(1)
-	atomic.AddInt64(&bc.metrics.activeFlush, 1)
-
+func (bc *BatchCache[T]) executeProcessor(id uint64, batch []T) {
 	go func() {
 		defer func() {
 			atomic.AddInt64(&bc.metrics.activeFlush, -1)
-			bc.pendingWg.Done()
+			bc.release(id, len(batch))
 		}()
 
 		// 获取信号量(如果有限制)
@@ -160,6 +321,6 @@ func (bc *BatchCache[T]) executeProcessor(batch []T) {
 			defer func() { bc.semaphore <- struct{}{} }()
 		}
 
-		bc.processor(batch)
+		bc.process(batch)
 	}()
 }
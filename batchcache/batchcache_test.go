@@ -1,6 +1,7 @@
 package batchcache
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -33,8 +34,8 @@ func TestBatchCache_ConcurrencyControl(t *testing.T) {
 	}
 
 	bc := New[string](2, 50*time.Millisecond, maxConcurrent, processor)
-	bc.Start()
-	defer bc.Stop()
+	bc.Start(context.Background())
+	defer bc.Stop(context.Background())
 
 	// 发送6个批次(应该会被限制为最多2个并发)
 	wg.Add(6)
@@ -64,10 +65,10 @@ func TestBatchCache_StopWaitsForCompletion(t *testing.T) {
 	}
 
 	bc := New[float64](1, time.Second, 0, processor)
-	bc.Start()
+	bc.Start(context.Background())
 
 	bc.Add(1.0)
-	bc.Stop() // 应该等待处理完成
+	bc.Stop(context.Background()) // 应该等待处理完成
 
 	select {
 	case <-done:
@@ -83,8 +84,8 @@ func TestBatchCache_Metrics(t *testing.T) {
 	processor := func(batch []rune) {}
 
 	bc := New[rune](5, time.Second, 0, processor)
-	bc.Start()
-	defer bc.Stop()
+	bc.Start(context.Background())
+	defer bc.Stop(context.Background())
 
 	bc.Add('a')
 	bc.Add('b')
@@ -106,8 +107,8 @@ func BenchmarkBatchCache(b *testing.B) {
 	processor := func(batch []int) {}
 
 	bc := New(1000, time.Minute, 0, processor)
-	bc.Start()
-	defer bc.Stop()
+	bc.Start(context.Background())
+	defer bc.Stop(context.Background())
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -121,8 +122,8 @@ func BenchmarkBatchCacheWithConcurrencyLimit(b *testing.B) {
 	}
 
 	bc := New[int](100, 10*time.Millisecond, 4, processor)
-	bc.Start()
-	defer bc.Stop()
+	bc.Start(context.Background())
+	defer bc.Stop(context.Background())
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,310 @@
+package batchcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeyedProcessFunc 按 key 分组的批处理函数.
+type KeyedProcessFunc[K comparable, T any] func(key K, batch []T) error
+
+// GroupFactory 为每个 key 创建 BatchCache, 可以按 key 设置不同的阈值、重试和容量.
+type GroupFactory[K comparable, T any] func(key K, processor ProcessFunc[T]) *BatchCache[T]
+
+// keyedGroup 一个 key 的分组.
+type keyedGroup[T any] struct {
+	cache    *BatchCache[T]
+	lastUsed atomic.Int64 // 最后一次 Add 的时间(unix nano)
+}
+
+// KeyedBatchCache 按 keyFunc 将数据分组, 每个分组有独立的缓冲区、阈值和刷新定时器.
+// 分组数量达到上限时淘汰最久未使用的分组, 空闲超过 idleTimeout 的分组也会被淘汰, 淘汰前处理剩余数据.
+// 被淘汰的分组处理完剩余数据后才会为同一个 key 创建新分组, maxConcurrent 为 1 时同一个 key 的数据按加入顺序处理.
+type KeyedBatchCache[K comparable, T any] struct {
+	keyFunc     func(T) K
+	factory     GroupFactory[K, T]
+	processor   KeyedProcessFunc[K, T]
+	maxGroups   int           // 最大分组数 (0表示无限制)
+	idleTimeout time.Duration // 分组空闲淘汰时间 (0表示不淘汰)
+
+	mutex   sync.Mutex
+	groups  map[K]*keyedGroup[T]
+	evicted map[K]chan struct{} // 淘汰中的分组, 处理完剩余数据后关闭
+	ctx     context.Context
+	started bool
+	closed  bool
+
+	stopChan  chan struct{}
+	stopOnce  sync.Once
+	wg        sync.WaitGroup // 后台淘汰任务
+	evictWg   sync.WaitGroup // 淘汰中的分组
+	evictions atomic.Int64
+}
+
+// NewKeyed 创建按 key 分组的 BatchCache, 每个分组的阈值为 maxItems 和 flushInterval, 并发处理数为 maxConcurrent.
+func NewKeyed[K comparable, T any](
+	keyFunc func(T) K,
+	maxItems int,
+	flushInterval time.Duration,
+	maxConcurrent int,
+	processor KeyedProcessFunc[K, T],
+) *KeyedBatchCache[K, T] {
+	return &KeyedBatchCache[K, T]{
+		keyFunc:   keyFunc,
+		processor: processor,
+		factory: func(_ K, processor ProcessFunc[T]) *BatchCache[T] {
+			return NewWithError(maxItems, flushInterval, maxConcurrent, processor)
+		},
+		groups:   make(map[K]*keyedGroup[T]),
+		evicted:  make(map[K]chan struct{}),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// WithGroupFactory 设置分组的创建函数.
+func (kc *KeyedBatchCache[K, T]) WithGroupFactory(factory GroupFactory[K, T]) *KeyedBatchCache[K, T] {
+	kc.factory = factory
+	return kc
+}
+
+// WithMaxGroups 设置最大分组数, 达到上限时淘汰最久未使用的分组.
+func (kc *KeyedBatchCache[K, T]) WithMaxGroups(maxGroups int) *KeyedBatchCache[K, T] {
+	kc.maxGroups = maxGroups
+	return kc
+}
+
+// WithIdleTimeout 设置分组空闲淘汰时间, 每 idleTimeout/2 (至少 minEvictInterval) 检查一次.
+func (kc *KeyedBatchCache[K, T]) WithIdleTimeout(idleTimeout time.Duration) *KeyedBatchCache[K, T] {
+	kc.idleTimeout = idleTimeout
+	return kc
+}
+
+// Start 启动所有分组和空闲淘汰, 重复调用无效.
+func (kc *KeyedBatchCache[K, T]) Start(ctx context.Context) {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+	if kc.started || kc.closed {
+		return
+	}
+	kc.started = true
+	kc.ctx = ctx
+	for _, group := range kc.groups {
+		group.cache.Start(ctx)
+	}
+	if kc.idleTimeout > 0 {
+		kc.wg.Add(1)
+		go kc.runEvict()
+	}
+}
+
+// Stop 停止所有分组, 处理剩余数据并等待完成, 可以重复调用.
+func (kc *KeyedBatchCache[K, T]) Stop(ctx context.Context) error {
+	kc.mutex.Lock()
+	kc.closed = true
+	groups := make([]*BatchCache[T], 0, len(kc.groups))
+	for key, group := range kc.groups {
+		groups = append(groups, group.cache)
+		delete(kc.groups, key)
+	}
+	kc.mutex.Unlock()
+	kc.stopOnce.Do(func() { close(kc.stopChan) })
+
+	errs := make([]error, len(groups))
+	var wg sync.WaitGroup
+	for idx, group := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[idx] = group.Stop(ctx)
+		}()
+	}
+	wg.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		kc.wg.Wait()
+		kc.evictWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, ctx.Err())
+	}
+	return errors.Join(errs...)
+}
+
+// Add 将数据加入所属的分组.
+func (kc *KeyedBatchCache[K, T]) Add(item T) error {
+	return kc.AddContext(context.Background(), item)
+}
+
+// AddContext 将数据加入所属的分组, 分组的 OverflowBlock 策略下阻塞直到有空间或 ctx 结束.
+func (kc *KeyedBatchCache[K, T]) AddContext(ctx context.Context, item T) error {
+	key := kc.keyFunc(item)
+	for {
+		group, err := kc.group(ctx, key)
+		if err != nil {
+			return err
+		}
+		err = group.cache.AddContext(ctx, item)
+		// 分组在获取后被淘汰, 重新创建分组
+		if !errors.Is(err, ErrClosed) {
+			return err
+		}
+	}
+}
+
+// Flush 同步处理所有分组当前缓冲区的数据.
+func (kc *KeyedBatchCache[K, T]) Flush(ctx context.Context) error {
+	kc.mutex.Lock()
+	groups := make([]*BatchCache[T], 0, len(kc.groups))
+	for _, group := range kc.groups {
+		groups = append(groups, group.cache)
+	}
+	kc.mutex.Unlock()
+
+	errs := make([]error, len(groups))
+	var wg sync.WaitGroup
+	for idx, group := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[idx] = group.Flush(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Groups 当前的分组数.
+func (kc *KeyedBatchCache[K, T]) Groups() int {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+	return len(kc.groups)
+}
+
+// Evictions 累计淘汰的分组数.
+func (kc *KeyedBatchCache[K, T]) Evictions() int {
+	return int(kc.evictions.Load())
+}
+
+// QueueLength 所有分组缓冲区的数据项数.
+func (kc *KeyedBatchCache[K, T]) QueueLength() int {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+	var length int
+	for _, group := range kc.groups {
+		length += group.cache.QueueLength()
+	}
+	return length
+}
+
+// group 获取或创建分组, key 的旧分组正在淘汰时等待其处理完成.
+func (kc *KeyedBatchCache[K, T]) group(ctx context.Context, key K) (*keyedGroup[T], error) {
+	for {
+		group, evicted, err := kc.loadOrCreate(key)
+		if evicted == nil {
+			return group, err
+		}
+		select {
+		case <-evicted:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// loadOrCreate 获取或创建分组, key 的旧分组正在淘汰时返回其完成通知.
+func (kc *KeyedBatchCache[K, T]) loadOrCreate(key K) (*keyedGroup[T], <-chan struct{}, error) {
+	now := time.Now().UnixNano()
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+	if kc.closed || (kc.started && kc.ctx.Err() != nil) {
+		return nil, nil, ErrClosed
+	}
+	if group, ok := kc.groups[key]; ok {
+		group.lastUsed.Store(now)
+		return group, nil, nil
+	}
+	if evicted, ok := kc.evicted[key]; ok {
+		return nil, evicted, nil
+	}
+	if kc.maxGroups > 0 && len(kc.groups) >= kc.maxGroups {
+		kc.evictOldest()
+	}
+	group := &keyedGroup[T]{
+		cache: kc.factory(key, func(batch []T) error {
+			return kc.processor(key, batch)
+		}),
+	}
+	group.lastUsed.Store(now)
+	if kc.started {
+		group.cache.Start(kc.ctx)
+	}
+	kc.groups[key] = group
+	return group, nil, nil
+}
+
+// evictOldest 淘汰最久未使用的分组, 调用时需要持有锁.
+func (kc *KeyedBatchCache[K, T]) evictOldest() {
+	var oldestKey K
+	var oldest int64
+	found := false
+	for key, group := range kc.groups {
+		if used := group.lastUsed.Load(); !found || used < oldest {
+			oldestKey, oldest, found = key, used, true
+		}
+	}
+	if found {
+		kc.evict(oldestKey)
+	}
+}
+
+// evict 从分组中移除并在后台停止, 调用时需要持有锁.
+func (kc *KeyedBatchCache[K, T]) evict(key K) {
+	group := kc.groups[key]
+	delete(kc.groups, key)
+	done := make(chan struct{})
+	kc.evicted[key] = done
+	kc.evictions.Add(1)
+	kc.evictWg.Add(1)
+	go func() {
+		defer kc.evictWg.Done()
+		_ = group.cache.Stop(context.Background())
+		kc.mutex.Lock()
+		delete(kc.evicted, key)
+		kc.mutex.Unlock()
+		close(done)
+	}()
+}
+
+// minEvictInterval 空闲淘汰的最小检查间隔.
+const minEvictInterval = time.Millisecond
+
+// runEvict 定时淘汰空闲分组.
+func (kc *KeyedBatchCache[K, T]) runEvict() {
+	defer kc.wg.Done()
+	ticker := time.NewTicker(max(kc.idleTimeout/2, minEvictInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-kc.stopChan:
+			return
+		case <-kc.ctx.Done():
+			return
+		case <-ticker.C:
+			deadline := time.Now().Add(-kc.idleTimeout).UnixNano()
+			kc.mutex.Lock()
+			for key, group := range kc.groups {
+				if group.lastUsed.Load() < deadline && group.cache.Pending() == 0 {
+					kc.evict(key)
+				}
+			}
+			kc.mutex.Unlock()
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package batchcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type keyedEvent struct {
+	table string
+	value int
+}
+
+func TestKeyedBatchCache_Grouping(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		batches = make(map[string][][]int)
+	)
+	processor := func(table string, batch []keyedEvent) error {
+		values := make([]int, 0, len(batch))
+		for _, event := range batch {
+			if event.table != table {
+				t.Errorf("event of %s processed in group %s", event.table, table)
+			}
+			values = append(values, event.value)
+		}
+		mu.Lock()
+		batches[table] = append(batches[table], values)
+		mu.Unlock()
+		return nil
+	}
+
+	kc := NewKeyed(func(e keyedEvent) string { return e.table }, 2, time.Hour, 0, processor).
+		WithGroupFactory(func(table string, processor ProcessFunc[keyedEvent]) *BatchCache[keyedEvent] {
+			// logs 表使用更大的阈值
+			if table == "logs" {
+				return NewWithError(100, time.Hour, 0, processor)
+			}
+			return NewWithError(2, time.Hour, 0, processor)
+		})
+	kc.Start(context.Background())
+	for i := 0; i < 4; i++ {
+		_ = kc.Add(keyedEvent{table: "users", value: i})
+		_ = kc.Add(keyedEvent{table: "logs", value: i})
+	}
+	if kc.Groups() != 2 {
+		t.Errorf("expected 2 groups, got %d", kc.Groups())
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	var users int
+	for _, batch := range batches["users"] {
+		users += len(batch)
+	}
+	if users != 4 || len(batches["logs"]) != 0 {
+		t.Errorf("unexpected batches before stop %v", batches)
+	}
+	mu.Unlock()
+
+	if err := kc.Stop(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(batches["logs"]) != 1 || len(batches["logs"][0]) != 4 {
+		t.Errorf("expected logs flushed on stop, got %v", batches["logs"])
+	}
+	if err := kc.Add(keyedEvent{table: "users"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestKeyedBatchCache_MaxGroups(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		processed = make(map[int]int)
+	)
+	kc := NewKeyed(func(v int) int { return v % 10 }, 100, time.Hour, 0, func(key int, batch []int) error {
+		mu.Lock()
+		processed[key] += len(batch)
+		mu.Unlock()
+		return nil
+	}).WithMaxGroups(2)
+	kc.Start(context.Background())
+	defer kc.Stop(context.Background())
+
+	_ = kc.Add(1)
+	time.Sleep(time.Millisecond)
+	_ = kc.Add(2)
+	time.Sleep(time.Millisecond)
+	_ = kc.Add(11) // 使用分组 1, 分组 2 成为最久未使用
+	_ = kc.Add(3)  // 淘汰分组 2
+
+	if kc.Groups() != 2 || kc.Evictions() != 1 {
+		t.Errorf("expected 2 groups and 1 eviction, got %d and %d", kc.Groups(), kc.Evictions())
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if processed[2] != 1 || processed[1] != 0 {
+		t.Errorf("expected evicted group flushed, got %v", processed)
+	}
+}
+
+func TestKeyedBatchCache_IdleEviction(t *testing.T) {
+	kc := NewKeyed(func(v int) int { return v }, 1, time.Hour, 0, func(int, []int) error { return nil }).
+		WithIdleTimeout(20 * time.Millisecond)
+	kc.Start(context.Background())
+	defer kc.Stop(context.Background())
+
+	_ = kc.Add(1)
+	_ = kc.Add(2)
+	if kc.Groups() != 2 {
+		t.Errorf("expected 2 groups, got %d", kc.Groups())
+	}
+	time.Sleep(100 * time.Millisecond)
+	if kc.Groups() != 0 {
+		t.Errorf("expected idle groups evicted, got %d", kc.Groups())
+	}
+	if err := kc.Add(1); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := kc.Flush(context.Background()); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestKeyedBatchCache_EvictionOrdering(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		order []int
+	)
+	// 只保留一个分组, key 交替时每次都淘汰另一个分组
+	kc := NewKeyed(func(v int) int { return v % 2 }, 100, time.Hour, 1, func(key int, batch []int) error {
+		if key == 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		mu.Lock()
+		for _, v := range batch {
+			if v%2 == 0 {
+				order = append(order, v)
+			}
+		}
+		mu.Unlock()
+		return nil
+	}).WithMaxGroups(1)
+	kc.Start(context.Background())
+
+	for i := range 10 {
+		if err := kc.Add(i); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if err := kc.Stop(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for idx := 1; idx < len(order); idx++ {
+		if order[idx] < order[idx-1] {
+			t.Fatalf("expected key 0 processed in order, got %v", order)
+		}
+	}
+	if len(order) != 5 {
+		t.Errorf("expected 5 items for key 0, got %v", order)
+	}
+}
+
+func TestKeyedBatchCache_TinyIdleTimeout(t *testing.T) {
+	kc := NewKeyed(func(v int) int { return v }, 10, time.Hour, 0, func(int, []int) error { return nil }).
+		WithIdleTimeout(time.Nanosecond)
+	kc.Start(context.Background())
+	_ = kc.Add(1)
+	time.Sleep(10 * time.Millisecond)
+	if err := kc.Stop(context.Background()); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
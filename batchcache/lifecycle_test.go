@@ -0,0 +1,144 @@
+package batchcache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatchCache_StopIdempotentAndAddAfterStop(t *testing.T) {
+	var processed atomic.Int64
+	bc := New[int](10, time.Hour, 0, func(batch []int) {
+		processed.Add(int64(len(batch)))
+	})
+	bc.Start(context.Background())
+	_ = bc.Add(1)
+	_ = bc.Add(2)
+
+	if err := bc.Stop(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := bc.Stop(context.Background()); err != nil {
+		t.Fatalf("unexpected error on second stop %v", err)
+	}
+	if processed.Load() != 2 {
+		t.Errorf("expected 2 processed, got %d", processed.Load())
+	}
+	if err := bc.Add(3); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestBatchCache_StopWithoutStart(t *testing.T) {
+	var processed atomic.Int64
+	bc := New[int](10, time.Hour, 0, func(batch []int) {
+		processed.Add(int64(len(batch)))
+	})
+	_ = bc.Add(1)
+	if err := bc.Stop(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if processed.Load() != 1 {
+		t.Errorf("expected 1 processed, got %d", processed.Load())
+	}
+}
+
+func TestBatchCache_StopDeadline(t *testing.T) {
+	failed := make(chan []int, 1)
+	bc := NewWithError[int](10, time.Hour, 0, func(batch []int) error {
+		return errors.New("downstream unavailable")
+	}).WithRetry(100, time.Hour, time.Hour).WithFailureHandler(func(batch []int, err error) {
+		failed <- batch
+	})
+	bc.Start(context.Background())
+	_ = bc.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := bc.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	// 超时后放弃重试, 交给失败处理函数
+	select {
+	case batch := <-failed:
+		if len(batch) != 1 {
+			t.Errorf("expected 1 failed item, got %d", len(batch))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("retry not aborted")
+	}
+}
+
+func TestBatchCache_StartContextCanceled(t *testing.T) {
+	var processed atomic.Int64
+	bc := New[int](10, time.Hour, 0, func(batch []int) {
+		processed.Add(int64(len(batch)))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	bc.Start(ctx)
+	_ = bc.Add(1)
+	cancel()
+	if err := bc.Stop(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if processed.Load() != 1 {
+		t.Errorf("expected 1 processed, got %d", processed.Load())
+	}
+	if err := bc.Add(2); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestBatchCache_Flush(t *testing.T) {
+	var processed atomic.Int64
+	bc := New[int](10, time.Hour, 0, func(batch []int) {
+		time.Sleep(50 * time.Millisecond)
+		processed.Add(int64(len(batch)))
+	})
+	bc.Start(context.Background())
+	defer bc.Stop(context.Background())
+	_ = bc.Add(1)
+	_ = bc.Add(2)
+
+	if err := bc.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if processed.Load() != 2 {
+		t.Errorf("expected 2 processed after flush, got %d", processed.Load())
+	}
+	if err := bc.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error on empty flush %v", err)
+	}
+
+	_ = bc.Add(3)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bc.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestBatchCache_FlushWaitsInFlight(t *testing.T) {
+	var processed atomic.Int64
+	bc := New[int](2, time.Hour, 0, func(batch []int) {
+		time.Sleep(100 * time.Millisecond)
+		processed.Add(int64(len(batch)))
+	})
+	bc.Start(context.Background())
+	defer bc.Stop(context.Background())
+	_ = bc.Add(1)
+	_ = bc.Add(2)
+	// 等待后台循环取走这一批, 此时缓冲区为空, Flush 仍需等待其处理完成
+	for bc.QueueLength() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := bc.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if processed.Load() != 2 {
+		t.Errorf("expected 2 processed after flush, got %d", processed.Load())
+	}
+}
@@ -0,0 +1,74 @@
+package batchcache
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/mmtbak/microlibrary/limiter"
+)
+
+// OverflowPolicy 待处理数据达到上限时的处理策略.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock 阻塞直到有空间或 ctx 结束
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest 丢弃新加入的数据
+	OverflowDropNewest
+	// OverflowDropOldest 丢弃缓冲区中最早的数据
+	OverflowDropOldest
+	// OverflowError 返回 ErrBufferFull
+	OverflowError
+)
+
+var (
+	// ErrBufferFull 待处理数据达到上限
+	ErrBufferFull = errors.New("batchcache: buffer full")
+	// ErrMemoryLimit 进程内存达到限制
+	ErrMemoryLimit = errors.New("batchcache: memory limit reached")
+)
+
+// WithCapacity 设置待处理数据(缓冲区和处理中的批次)的上限, 达到上限时按 policy 处理, 0 表示不限制.
+func (bc *BatchCache[T]) WithCapacity(maxPending int, policy OverflowPolicy) *BatchCache[T] {
+	bc.maxPending = maxPending
+	bc.overflow = policy
+	return bc
+}
+
+// WithMemoryLimiter 进程内存达到限制时拒绝新数据, 返回 ErrMemoryLimit.
+func (bc *BatchCache[T]) WithMemoryLimiter(l *limiter.MemoryLimiter) *BatchCache[T] {
+	bc.memoryLimiter = l
+	return bc
+}
+
+// Pending 待处理的数据项数, 包括缓冲区和处理中的批次.
+func (bc *BatchCache[T]) Pending() int {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+	return bc.pending
+}
+
+// Dropped 累计丢弃或拒绝的数据项数.
+func (bc *BatchCache[T]) Dropped() int {
+	return int(atomic.LoadInt64(&bc.metrics.dropped))
+}
+
+// release 批次处理完成, 释放空间并唤醒等待的 Add 和 Flush.
+func (bc *BatchCache[T]) release(id uint64, n int) {
+	bc.mutex.Lock()
+	close(bc.inflight[id])
+	delete(bc.inflight, id)
+	bc.pending -= n
+	close(bc.spaceChan)
+	bc.spaceChan = make(chan struct{})
+	bc.mutex.Unlock()
+}
+
+// trigger 触发刷新.
+func (bc *BatchCache[T]) trigger() {
+	select {
+	case bc.freshTriggerChan <- struct{}{}: // 非阻塞发送
+	default:
+		// 通道已满说明已有待处理信号
+	}
+}
@@ -0,0 +1,107 @@
+package batchcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmtbak/microlibrary/limiter"
+)
+
+func TestBatchCache_OverflowPolicies(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		processed []int
+	)
+	processor := func(batch []int) {
+		mu.Lock()
+		processed = append(processed, batch...)
+		mu.Unlock()
+	}
+
+	// 未启动时不会刷新, 缓冲区保持满的状态
+	bc := New[int](10, time.Hour, 0, processor).WithCapacity(3, OverflowError)
+	for i := 0; i < 3; i++ {
+		if err := bc.Add(i); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if err := bc.Add(3); !errors.Is(err, ErrBufferFull) {
+		t.Errorf("expected ErrBufferFull, got %v", err)
+	}
+
+	bc = New[int](10, time.Hour, 0, processor).WithCapacity(3, OverflowDropNewest)
+	for i := 0; i < 5; i++ {
+		_ = bc.Add(i)
+	}
+	if bc.Pending() != 3 || bc.Dropped() != 2 {
+		t.Errorf("expected 3 pending and 2 dropped, got %d and %d", bc.Pending(), bc.Dropped())
+	}
+
+	bc = New[int](10, time.Hour, 0, processor).WithCapacity(3, OverflowDropOldest)
+	for i := 0; i < 5; i++ {
+		_ = bc.Add(i)
+	}
+	bc.Start(context.Background())
+	bc.Stop(context.Background())
+	if len(processed) != 3 || processed[0] != 2 || processed[2] != 4 {
+		t.Errorf("expected oldest items dropped, got %v", processed)
+	}
+}
+
+func TestBatchCache_OverflowBlock(t *testing.T) {
+	release := make(chan struct{})
+	processor := func(batch []int) {
+		<-release
+	}
+
+	bc := New[int](2, time.Hour, 1, processor).WithCapacity(2, OverflowBlock)
+	bc.Start(context.Background())
+	defer bc.Stop(context.Background())
+	_ = bc.Add(1)
+	_ = bc.Add(2)
+
+	// 批次处理中, 待处理数据仍然达到上限
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := bc.AddContext(ctx, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	added := make(chan error, 1)
+	go func() {
+		added <- bc.AddContext(context.Background(), 4)
+	}()
+	select {
+	case <-added:
+		t.Fatal("Add should block until batch processed")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Add not unblocked")
+	}
+}
+
+func TestBatchCache_MemoryLimiter(t *testing.T) {
+	l := limiter.NewMemoryLimiter(1024)
+	l.CurrentMemStats.HeapSys = 4096
+	bc := New[int](10, time.Hour, 0, func([]int) {}).WithMemoryLimiter(l)
+	if err := bc.Add(1); !errors.Is(err, ErrMemoryLimit) {
+		t.Errorf("expected ErrMemoryLimit, got %v", err)
+	}
+	l.CurrentMemStats.HeapSys = 512
+	if err := bc.Add(1); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if bc.Dropped() != 1 {
+		t.Errorf("expected 1 dropped, got %d", bc.Dropped())
+	}
+}
@@ -0,0 +1,150 @@
+package batchcache
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// ProcessFunc 批处理函数, 返回 error 时整批重试, 返回 *PartialError 时只重试失败的数据项.
+type ProcessFunc[T any] func(batch []T) error
+
+// FailureHandler 重试耗尽后仍然失败的数据项, 可以写入死信队列.
+type FailureHandler[T any] func(batch []T, err error)
+
+// PartialError 部分数据项处理失败, Failed 为失败数据项在批次中的下标.
+type PartialError struct {
+	Failed map[int]error
+}
+
+// NewPartialError new partial error.
+func NewPartialError() *PartialError {
+	return &PartialError{Failed: make(map[int]error)}
+}
+
+// Add 记录下标为 index 的数据项失败.
+func (e *PartialError) Add(index int, err error) {
+	e.Failed[index] = err
+}
+
+// Error error.
+func (e *PartialError) Error() string {
+	for _, index := range e.indexes() {
+		return fmt.Sprintf("batchcache: %d items failed, item %d: %v", len(e.Failed), index, e.Failed[index])
+	}
+	return "batchcache: no items failed"
+}
+
+// indexes 按顺序返回失败的下标.
+func (e *PartialError) indexes() []int {
+	indexes := make([]int, 0, len(e.Failed))
+	for index := range e.Failed {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+	return indexes
+}
+
+// retryOption 重试配置.
+type retryOption struct {
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// minRetryBackoff 最小重试间隔, 避免 initialBackoff 不大于0时无间隔地重试.
+const minRetryBackoff = time.Millisecond
+
+// WithRetry 处理失败时最多重试 maxRetries 次, 重试间隔从 initialBackoff 开始指数增长, 不超过 maxBackoff.
+// initialBackoff 小于 minRetryBackoff 时使用 minRetryBackoff, maxBackoff 不大于0时不限制重试间隔.
+func (bc *BatchCache[T]) WithRetry(maxRetries int, initialBackoff, maxBackoff time.Duration) *BatchCache[T] {
+	maxRetries = max(maxRetries, 0)
+	initialBackoff = max(initialBackoff, minRetryBackoff)
+	if maxBackoff > 0 {
+		maxBackoff = max(maxBackoff, initialBackoff)
+	}
+	bc.retry = retryOption{
+		maxRetries:     maxRetries,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+	}
+	return bc
+}
+
+// WithFailureHandler 设置重试耗尽后的处理函数, 未设置时记录错误日志.
+func (bc *BatchCache[T]) WithFailureHandler(handler FailureHandler[T]) *BatchCache[T] {
+	bc.onFailure = handler
+	return bc
+}
+
+// Retries 累计重试次数.
+func (bc *BatchCache[T]) Retries() int {
+	return int(atomic.LoadInt64(&bc.metrics.retries))
+}
+
+// FailedItems 累计重试耗尽后失败的数据项数.
+func (bc *BatchCache[T]) FailedItems() int {
+	return int(atomic.LoadInt64(&bc.metrics.failedItems))
+}
+
+// process 调用处理函数, 失败时按配置重试.
+func (bc *BatchCache[T]) process(batch []T) {
+	backoff := bc.retry.initialBackoff
+	for attempt := 0; ; attempt++ {
+		err := bc.processor(batch)
+		if err == nil {
+			return
+		}
+		var partial *PartialError
+		if errors.As(err, &partial) {
+			if len(partial.Failed) == 0 {
+				return
+			}
+			failed := make([]T, 0, len(partial.Failed))
+			for _, index := range partial.indexes() {
+				if index >= 0 && index < len(batch) {
+					failed = append(failed, batch[index])
+				}
+			}
+			batch = failed
+		}
+		if attempt >= bc.retry.maxRetries || !bc.wait(backoff) {
+			atomic.AddInt64(&bc.metrics.failedItems, int64(len(batch)))
+			if bc.onFailure != nil {
+				bc.onFailure(batch, err)
+			} else {
+				slog.Error("batchcache: process batch failed", "items", len(batch), "attempts", attempt+1, "error", err)
+			}
+			return
+		}
+		atomic.AddInt64(&bc.metrics.retries, 1)
+		backoff = bc.retry.next(backoff)
+	}
+}
+
+// next 下一次重试间隔, 翻倍后不超过 maxBackoff, maxBackoff 不大于0时只防止溢出.
+func (r retryOption) next(backoff time.Duration) time.Duration {
+	if backoff > math.MaxInt64/2 {
+		return math.MaxInt64
+	}
+	if r.maxBackoff > 0 {
+		return min(backoff*2, r.maxBackoff)
+	}
+	return backoff * 2
+}
+
+// wait 等待重试间隔, Stop 超时时返回 false.
+func (bc *BatchCache[T]) wait(backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-bc.abortChan:
+		return false
+	}
+}
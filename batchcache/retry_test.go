@@ -0,0 +1,144 @@
+package batchcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchCache_Retry(t *testing.T) {
+	var attempts int
+	done := make(chan []int, 1)
+	processor := func(batch []int) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("temporary error")
+		}
+		done <- batch
+		return nil
+	}
+
+	bc := NewWithError[int](2, time.Second, 0, processor).WithRetry(3, time.Millisecond, 5*time.Millisecond)
+	bc.Start(context.Background())
+	defer bc.Stop(context.Background())
+	bc.Add(1)
+	bc.Add(2)
+
+	select {
+	case batch := <-done:
+		if len(batch) != 2 {
+			t.Errorf("expected 2 items, got %d", len(batch))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("batch not processed")
+	}
+	if bc.Retries() != 2 {
+		t.Errorf("expected 2 retries, got %d", bc.Retries())
+	}
+}
+
+func TestBatchCache_PartialRetryAndFailureHandler(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		batches  [][]string
+		failed   []string
+		failures = make(chan error, 1)
+	)
+	processor := func(batch []string) error {
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+		partial := NewPartialError()
+		for idx, item := range batch {
+			if item == "bad" {
+				partial.Add(idx, errors.New("invalid item"))
+			}
+		}
+		return partial
+	}
+
+	bc := NewWithError[string](3, time.Second, 0, processor).
+		WithRetry(2, time.Millisecond, time.Millisecond).
+		WithFailureHandler(func(batch []string, err error) {
+			failed = batch
+			failures <- err
+		})
+	bc.Start(context.Background())
+	bc.Add("a")
+	bc.Add("bad")
+	bc.Add("c")
+
+	select {
+	case err := <-failures:
+		var partial *PartialError
+		if !errors.As(err, &partial) {
+			t.Errorf("expected partial error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failure handler not called")
+	}
+	bc.Stop(context.Background())
+
+	// 第一次处理整批, 之后只重试失败的数据项
+	if len(batches) != 3 || len(batches[0]) != 3 || len(batches[1]) != 1 || len(batches[2]) != 1 {
+		t.Errorf("unexpected batches %v", batches)
+	}
+	if len(failed) != 1 || failed[0] != "bad" {
+		t.Errorf("unexpected failed items %v", failed)
+	}
+	if bc.FailedItems() != 1 {
+		t.Errorf("expected 1 failed item, got %d", bc.FailedItems())
+	}
+}
+
+func TestBatchCache_RetryBackoff(t *testing.T) {
+	bc := NewWithError[int](1, time.Second, 0, func([]int) error { return nil })
+	bc.WithRetry(3, 0, 0)
+	if bc.retry.initialBackoff != minRetryBackoff {
+		t.Errorf("expected initial backoff %v, got %v", minRetryBackoff, bc.retry.initialBackoff)
+	}
+	// maxBackoff 不大于0时不限制, 重试间隔继续翻倍
+	backoff := bc.retry.initialBackoff
+	for _, expected := range []time.Duration{2 * time.Millisecond, 4 * time.Millisecond, 8 * time.Millisecond} {
+		backoff = bc.retry.next(backoff)
+		if backoff != expected {
+			t.Errorf("expected backoff %v, got %v", expected, backoff)
+		}
+	}
+
+	bc.WithRetry(3, 2*time.Millisecond, 3*time.Millisecond)
+	if backoff = bc.retry.next(bc.retry.initialBackoff); backoff != 3*time.Millisecond {
+		t.Errorf("expected backoff capped to 3ms, got %v", backoff)
+	}
+}
+
+func TestBatchCache_RetryUncapped(t *testing.T) {
+	var attempts int
+	done := make(chan struct{})
+	processor := func(batch []int) error {
+		attempts++
+		if attempts <= 3 {
+			return errors.New("temporary error")
+		}
+		close(done)
+		return nil
+	}
+
+	bc := NewWithError[int](1, time.Second, 0, processor).WithRetry(3, 0, 0)
+	bc.Start(context.Background())
+	defer bc.Stop(context.Background())
+	start := time.Now()
+	bc.Add(1)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("batch not processed")
+	}
+	// 重试间隔为 1ms, 2ms, 4ms
+	if elapsed := time.Since(start); elapsed < 7*time.Millisecond {
+		t.Errorf("expected retries to back off at least 7ms, got %v", elapsed)
+	}
+}
@@ -0,0 +1,48 @@
+package batchcache
+
+// WithSizer 设置数据项大小的计算函数, 缓冲区累计大小达到 maxBytes 时触发刷新,
+// 提交处理时按 maxBytes 拆分批次, 超过 maxBytes 的单个数据项单独成为一批. 缓冲区中已有的数据会重新计算大小.
+func (bc *BatchCache[T]) WithSizer(sizer func(T) int, maxBytes int) *BatchCache[T] {
+	bc.mutex.Lock()
+	bc.sizer = sizer
+	bc.maxBytes = maxBytes
+	bc.sizes, bc.bufferBytes = nil, 0
+	if sizer != nil {
+		bc.sizes = make([]int, 0, len(bc.buffer))
+		for _, item := range bc.buffer {
+			size := sizer(item)
+			bc.sizes = append(bc.sizes, size)
+			bc.bufferBytes += size
+		}
+	}
+	needFlush := maxBytes > 0 && bc.bufferBytes >= maxBytes
+	bc.mutex.Unlock()
+	if needFlush {
+		bc.trigger()
+	}
+	return bc
+}
+
+// BufferBytes 缓冲区数据的累计大小, 未设置 sizer 时为 0.
+func (bc *BatchCache[T]) BufferBytes() int {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+	return bc.bufferBytes
+}
+
+// splitBytes 按 maxBytes 拆分批次.
+func splitBytes[T any](batch []T, sizes []int, maxBytes int) [][]T {
+	if maxBytes <= 0 || len(sizes) != len(batch) {
+		return [][]T{batch}
+	}
+	var batches [][]T
+	var start, bytes int
+	for idx, size := range sizes {
+		if idx > start && bytes+size > maxBytes {
+			batches = append(batches, batch[start:idx])
+			start, bytes = idx, 0
+		}
+		bytes += size
+	}
+	return append(batches, batch[start:])
+}
@@ -0,0 +1,80 @@
+package batchcache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchCache_MaxBytes(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		batches [][]string
+	)
+	bc := New[string](100, time.Hour, 0, func(batch []string) {
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+	}).WithSizer(func(s string) int { return len(s) }, 10)
+	bc.Start(context.Background())
+	defer bc.Stop(context.Background())
+
+	_ = bc.Add("aaaa")
+	_ = bc.Add("bbbb")
+	if bc.BufferBytes() != 8 {
+		t.Errorf("expected 8 buffered bytes, got %d", bc.BufferBytes())
+	}
+	_ = bc.Add("cccc") // 达到 maxBytes 触发刷新
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	var total int
+	for _, batch := range batches {
+		if size := len(strings.Join(batch, "")); size > 10 {
+			t.Errorf("batch %v exceeds max bytes", batch)
+		}
+		total += len(batch)
+	}
+	mu.Unlock()
+	if total != 3 || bc.BufferBytes() != 0 {
+		t.Errorf("expected 3 items flushed by bytes, got %d, buffered %d", total, bc.BufferBytes())
+	}
+}
+
+func TestSplitBytes(t *testing.T) {
+	batch := []string{"aaaa", "bbbbbbbbbbbb", "cc", "dddd", "ee"}
+	sizes := []int{4, 12, 2, 4, 2}
+	chunks := splitBytes(batch, sizes, 8)
+	expected := [][]string{{"aaaa"}, {"bbbbbbbbbbbb"}, {"cc", "dddd", "ee"}}
+	if len(chunks) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, chunks)
+	}
+	for idx := range expected {
+		if strings.Join(chunks[idx], ",") != strings.Join(expected[idx], ",") {
+			t.Errorf("expected %v, got %v", expected, chunks)
+		}
+	}
+	if chunks := splitBytes(batch, nil, 8); len(chunks) != 1 {
+		t.Errorf("expected no split without sizes, got %v", chunks)
+	}
+}
+
+func TestBatchCache_SizerAfterAdd(t *testing.T) {
+	bc := New[string](100, time.Hour, 0, func([]string) {}).WithCapacity(2, OverflowDropOldest)
+	_ = bc.Add("a")
+	_ = bc.Add("bb")
+	// 已有数据重新计算大小, 丢弃旧数据时减去对应的大小
+	bc.WithSizer(func(s string) int { return len(s) }, 100)
+	if bc.BufferBytes() != 3 {
+		t.Errorf("expected 3 buffered bytes, got %d", bc.BufferBytes())
+	}
+	if err := bc.Add("ccc"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if bc.BufferBytes() != 5 || bc.Dropped() != 1 {
+		t.Errorf("expected 5 buffered bytes and 1 dropped, got %d and %d", bc.BufferBytes(), bc.Dropped())
+	}
+	_ = bc.Stop(context.Background())
+}
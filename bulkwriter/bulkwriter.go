@@ -19,8 +19,13 @@ type BulkWriter[T any] struct {
 	tick        time.Duration // 批处理定时时间长度
 	WriteFunc   func([]T)     // 回调批量处理函数 ，批量处理器
 	writerlimit int           // 最大writer数量
+	sizer       func(T) int   // 数据大小计算函数
+	bytelimit   int           // 批处理数据大小上限
+	sizes       []int         // buffer 中每条数据的大小, 设置 sizer 时记录
+	bufferbytes int           // buffer 数据的累计大小
 	ticker      *time.Ticker
 	bufferFull  chan interface{} // buffer满的信号量
+	bytesFull   chan struct{}    // buffer大小达到上限的信号(缓冲为1)
 	// 条件变量
 	cond *sync.Cond
 
@@ -48,6 +53,7 @@ func NewBulkWriter[T any](limit int, tick time.Duration, writefunc func([]T)) *B
 		ticker:     time.NewTicker(tick),
 		WriteFunc:  writefunc,
 		bufferFull: make(chan interface{}),
+		bytesFull:  make(chan struct{}, 1),
 		// 条件变量
 		cond: sync.NewCond(&sync.Mutex{}),
 	}
@@ -63,6 +69,9 @@ func NewBulkWriter[T any](limit int, tick time.Duration, writefunc func([]T)) *B
 			// buffer满了
 			case <-writer.bufferFull:
 				writer.Flush()
+			// buffer大小达到上限
+			case <-writer.bytesFull:
+				writer.Flush()
 			// 定时转存
 			case <-writer.ticker.C:
 				writer.Flush()
@@ -80,6 +89,26 @@ func (w *BulkWriter[T]) WithWriterLimit(limit int) *BulkWriter[T] {
 	return w
 }
 
+// WithSizer 设置数据大小计算函数, buffer 累计大小达到 bytelimit 时触发批处理, 每个批次的大小不超过 bytelimit,
+// 超过 bytelimit 的单条数据单独成为一个批次. buffer 中已有的数据会重新计算大小.
+func (w *BulkWriter[T]) WithSizer(sizer func(T) int, bytelimit int) *BulkWriter[T] {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sizer = sizer
+	w.bytelimit = bytelimit
+	w.sizes, w.bufferbytes = nil, 0
+	if sizer != nil {
+		w.sizes = make([]int, 0, len(w.buffer))
+		for _, value := range w.buffer {
+			size := sizer(value)
+			w.sizes = append(w.sizes, size)
+			w.bufferbytes += size
+		}
+	}
+	w.notifyBytesFull()
+	return w
+}
+
 // Flush 将已有buffer全部写回数据库，并发消息给Append函数：buffer已经刷清空.
 func (writer *BulkWriter[T]) Flush() {
 	writer.mu.Lock()
@@ -90,18 +119,27 @@ func (writer *BulkWriter[T]) Flush() {
 	case <-writer.bufferFull:
 	default:
 	}
+	select {
+	case <-writer.bytesFull:
+	default:
+	}
 
 	// 调用CBFunc
 	if len(writer.buffer) > 0 {
 		// 每次最多只读limit个，然后循环
 		for len(writer.buffer) > 0 {
-			readLen := min(len(writer.buffer), writer.msglimit)
+			readLen := writer.batchLen()
 			writer.pool.Invoke(writer.buffer[:readLen])
 
 			writer.buffer = writer.buffer[readLen:]
+			if writer.sizer != nil {
+				writer.sizes = writer.sizes[readLen:]
+			}
 		}
 		// 新建buffer
 		writer.buffer = make([]T, 0, writer.msglimit)
+		writer.sizes = nil
+		writer.bufferbytes = 0
 		writer.brocast()
 	}
 	// 重置ticker
@@ -128,7 +166,7 @@ func (writer *BulkWriter[T]) Append(values ...T) {
 
 	writer.mu.Lock()
 	// 先看看buffer是不是满了
-	for len(writer.buffer) >= writer.msglimit {
+	for writer.full() {
 		// 如果满了，释放锁，给Flush发消息，然后等到条件变量释放
 		writer.mu.Unlock()
 		writer.bufferFull <- nil
@@ -137,9 +175,51 @@ func (writer *BulkWriter[T]) Append(values ...T) {
 		writer.mu.Lock()
 	}
 	writer.buffer = append(writer.buffer, values...)
+	if writer.sizer != nil {
+		for _, value := range values {
+			size := writer.sizer(value)
+			writer.sizes = append(writer.sizes, size)
+			writer.bufferbytes += size
+		}
+		writer.notifyBytesFull()
+	}
 	writer.mu.Unlock()
 }
 
+// notifyBytesFull 数据大小达到上限时通知刷新, 调用方需持有 mu.
+func (writer *BulkWriter[T]) notifyBytesFull() {
+	if writer.sizer == nil || writer.bytelimit <= 0 || writer.bufferbytes < writer.bytelimit {
+		return
+	}
+	select {
+	case writer.bytesFull <- struct{}{}:
+	default:
+		// 通道已满说明已有待处理信号
+	}
+}
+
+// full buffer 数量或大小达到上限.
+func (writer *BulkWriter[T]) full() bool {
+	return len(writer.buffer) >= writer.msglimit ||
+		(writer.bytelimit > 0 && writer.bufferbytes >= writer.bytelimit)
+}
+
+// batchLen 下一个批次的数据条数, 不超过 msglimit 和 bytelimit.
+func (writer *BulkWriter[T]) batchLen() int {
+	readLen := min(len(writer.buffer), writer.msglimit)
+	if writer.sizer == nil || writer.bytelimit <= 0 {
+		return readLen
+	}
+	bytes := 0
+	for idx, size := range writer.sizes[:readLen] {
+		if idx > 0 && bytes+size > writer.bytelimit {
+			return idx
+		}
+		bytes += size
+	}
+	return readLen
+}
+
 func (writer *BulkWriter[T]) wait() {
 	writer.cond.L.Lock()
 	for len(writer.buffer) > writer.msglimit {
@@ -75,3 +75,45 @@ func BenchmarkBulkWriterPerfermance(*testing.B) {
 	time.Sleep(4 * time.Second)
 	fmt.Println("总量:", calcNum)
 }
+
+func TestBulkWriterByteLimit(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]string
+	wf := func(batch []string) {
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+	}
+	writer := NewBulkWriter(100, time.Hour, wf).WithSizer(func(s string) int { return len(s) }, 10)
+
+	writer.Append("aaaa", "bbbb")
+	mu.Lock()
+	assert.Equal(t, len(batches), 0)
+	mu.Unlock()
+
+	// 达到大小上限时触发批处理, 每个批次不超过上限
+	writer.Append("cccc", "dddddddddddd", "ee")
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, batches, [][]string{{"aaaa", "bbbb"}, {"cccc"}, {"dddddddddddd"}, {"ee"}})
+}
+
+func TestBulkWriterSizerAfterAppend(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]string
+	wf := func(batch []string) {
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+	}
+	writer := NewBulkWriter(100, time.Hour, wf)
+	writer.Append("aaaa", "bbbb", "cccc")
+	// 已有数据重新计算大小, 超过上限时按大小拆分
+	writer.WithSizer(func(s string) int { return len(s) }, 10)
+	writer.Flush()
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, batches, [][]string{{"aaaa", "bbbb"}, {"cccc"}})
+}
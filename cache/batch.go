@@ -0,0 +1,77 @@
+package cache
+
+import "time"
+
+// Result 批量读取中单个key的结果.
+type Result struct {
+	Key   []byte
+	Value []byte
+	Err   error
+}
+
+// Item 批量写入中的单个key/value.
+type Item struct {
+	Key        []byte
+	Value      []byte
+	Expiration time.Duration
+}
+
+// MultiCache 支持批量操作的缓存, 返回结果与输入按下标一一对应.
+type MultiCache interface {
+	Cache
+	// MGet 批量查询
+	MGet(keys [][]byte) []Result
+	// MSet 批量写入, 返回每个key的错误
+	MSet(items []Item) []error
+	// MDelete 批量删除, 返回每个key是否删除成功
+	MDelete(keys [][]byte) []bool
+}
+
+// MGet 批量查询, 后端不支持批量操作时逐个查询.
+func MGet(c Cache, keys [][]byte) []Result {
+	if mc, ok := c.(MultiCache); ok {
+		return mc.MGet(keys)
+	}
+	return mgetLoop(c, keys)
+}
+
+// MSet 批量写入, 后端不支持批量操作时逐个写入.
+func MSet(c Cache, items []Item) []error {
+	if mc, ok := c.(MultiCache); ok {
+		return mc.MSet(items)
+	}
+	return msetLoop(c, items)
+}
+
+// MDelete 批量删除, 后端不支持批量操作时逐个删除.
+func MDelete(c Cache, keys [][]byte) []bool {
+	if mc, ok := c.(MultiCache); ok {
+		return mc.MDelete(keys)
+	}
+	return mdeleteLoop(c, keys)
+}
+
+func mgetLoop(c Cache, keys [][]byte) []Result {
+	results := make([]Result, len(keys))
+	for idx, key := range keys {
+		results[idx].Key = key
+		results[idx].Value, results[idx].Err = c.Get(key)
+	}
+	return results
+}
+
+func msetLoop(c Cache, items []Item) []error {
+	errs := make([]error, len(items))
+	for idx, item := range items {
+		errs[idx] = c.Set(item.Key, item.Value, item.Expiration)
+	}
+	return errs
+}
+
+func mdeleteLoop(c Cache, keys [][]byte) []bool {
+	deleted := make([]bool, len(keys))
+	for idx, key := range keys {
+		deleted[idx] = c.Delete(key)
+	}
+	return deleted
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mmtbak/microlibrary/config"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// plainCache 只实现 Cache 接口, 用于测试逐个操作的回退实现
+type plainCache struct {
+	Cache
+}
+
+func testMultiCache(t *testing.T, c Cache) {
+	items := []Item{
+		{Key: []byte("key1"), Value: []byte("value1"), Expiration: time.Minute},
+		{Key: []byte("key2"), Value: []byte("value2"), Expiration: time.Minute},
+	}
+	errs := MSet(c, items)
+	assert.Equal(t, errs, []error{nil, nil})
+
+	results := MGet(c, [][]byte{[]byte("key1"), []byte("missing"), []byte("key2")})
+	assert.Equal(t, len(results), 3)
+	assert.Equal(t, string(results[0].Value), "value1")
+	assert.Equal(t, results[0].Err, nil)
+	assert.Equal(t, string(results[1].Key), "missing")
+	assert.Equal(t, IsErrNotFound(results[1].Err), true)
+	assert.Equal(t, string(results[2].Value), "value2")
+
+	deleted := MDelete(c, [][]byte{[]byte("key1"), []byte("missing")})
+	assert.Equal(t, deleted, []bool{true, false})
+	_, err := c.Get([]byte("key1"))
+	assert.Equal(t, IsErrNotFound(err), true)
+}
+
+func TestMultiCache(t *testing.T) {
+	newfreecache := func() *FreeCache {
+		c, err := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?sizekb=1000"})
+		assert.Equal(t, err, nil)
+		return c
+	}
+	server := miniredis.RunT(t)
+	rediscache, err := NewRedisCache(config.AccessPoint{Source: "redis://" + server.Addr()})
+	assert.Equal(t, err, nil)
+
+	testMultiCache(t, plainCache{newfreecache()})
+	testMultiCache(t, newfreecache())
+	testMultiCache(t, rediscache)
+	testMultiCache(t, NewTieredCacheWithBackend(newfreecache(), newfreecache(), time.Minute))
+}
+
+func TestTieredCacheMGetBackfill(t *testing.T) {
+	l1, _ := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?sizekb=1000"})
+	l2, _ := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?sizekb=1000"})
+	c := NewTieredCacheWithBackend(l1, l2, time.Minute)
+	_ = l2.Set([]byte("key1"), []byte("value1"), 0)
+
+	results := c.MGet([][]byte{[]byte("key1")})
+	assert.Equal(t, results[0].Err, nil)
+	v, err := l1.Get([]byte("key1"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(v), "value1")
+}
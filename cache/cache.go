@@ -8,7 +8,11 @@ import (
 	"github.com/mmtbak/microlibrary/config"
 )
 
+// NoExpiration 不过期.
+const NoExpiration time.Duration = 0
+
 // Cache interface.
+// expiration 为 NoExpiration 时不过期, 为负数时返回 ErrInvalidExpiration.
 type Cache interface {
 	// set 填入key/value
 	Set(key, value []byte, expiration time.Duration) error
@@ -20,16 +24,64 @@ type Cache interface {
 	Active(key []byte, expiration time.Duration) error
 }
 
+// ValueOptions 所有后端通用的 value 处理配置, 通过 AccessPoint.Options 配置, 先压缩后加密.
+type ValueOptions struct {
+	// Compression 压缩算法, zstd 或 snappy, 为空时不压缩
+	Compression string
+	// CompressThreshold value 长度不小于阈值时压缩
+	CompressThreshold int
+	// Encryption 加密配置, 为空时不加密
+	Encryption *EncryptionOptions
+}
+
 // NewCache new cache.
 func NewCache(conf config.AccessPoint) (Cache, error) {
+	var c Cache
 	var err error
 	dsn := conf.Decode()
 
 	switch dsn.Scheme {
 	case "freecache":
-		return NewFreecache(conf)
+		c, err = NewFreecache(conf)
+	case redisSchemas.Redis, redisSchemas.Sentinel, redisSchemas.Cluster:
+		c, err = NewRedisCache(conf)
+	case "memory":
+		c, err = NewMemoryCache(conf)
+	case "tiered":
+		c, err = NewTieredCache(conf)
 	default:
 		err = fmt.Errorf("cache: unsupported schema '%s'", dsn.Scheme)
 	}
-	return nil, err
+	if err != nil {
+		return nil, err
+	}
+	return wrapValue(c, conf)
+}
+
+// wrapValue 按 ValueOptions 添加压缩和加密.
+func wrapValue(c Cache, conf config.AccessPoint) (Cache, error) {
+	var options ValueOptions
+	if err := conf.DecodeOption(&options); err != nil {
+		return nil, err
+	}
+	var err error
+	if options.Compression != "" {
+		if c, err = NewCompressCache(c, options.Compression, options.CompressThreshold); err != nil {
+			return nil, err
+		}
+	}
+	if options.Encryption != nil {
+		if c, err = NewEncryptCacheWithOptions(c, *options.Encryption); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// checkExpiration 校验过期时间.
+func checkExpiration(expiration time.Duration) error {
+	if expiration < 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidExpiration, expiration)
+	}
+	return nil
 }
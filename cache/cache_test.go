@@ -5,7 +5,6 @@ import (
 	"testing"
 	"time"
 
-	"github.com/coocood/freecache"
 	"github.com/mmtbak/microlibrary/config"
 	"gopkg.in/go-playground/assert.v1"
 )
@@ -28,6 +27,6 @@ func TestCache(t *testing.T) {
 	c.Active(key, expireduration)
 	time.Sleep(2 * time.Second)
 	v, err = c.Get(key)
-	assert.Equal(t, err, freecache.ErrNotFound)
+	assert.Equal(t, err, ErrNotFound)
 	assert.Equal(t, bytes.Equal(v, value), false)
 }
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec value 编解码器.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec json 编解码.
+type JSONCodec struct{}
+
+// Marshal json marshal.
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal json unmarshal.
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec gob 编解码.
+type GobCodec struct{}
+
+// Marshal gob encode.
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal gob decode.
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// MsgpackCodec msgpack 编解码.
+type MsgpackCodec struct{}
+
+// Marshal msgpack marshal.
+func (MsgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal msgpack unmarshal.
+func (MsgpackCodec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// StringKey 字符串类型的 key 编码.
+func StringKey[K ~string](key K) []byte {
+	return []byte(key)
+}
+
+// FmtKey 使用 fmt.Sprint 编码 key, 适用于数字等基础类型.
+func FmtKey[K any](key K) []byte {
+	return []byte(fmt.Sprint(key))
+}
+
+// JSONKey 使用 json 编码 key, 适用于结构体类型的复合 key.
+func JSONKey[K any](key K) []byte {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return []byte(fmt.Sprint(key))
+	}
+	return data
+}
+
+// PrefixKey 给 key 编码增加前缀.
+func PrefixKey[K any](prefix string, encoder func(K) []byte) func(K) []byte {
+	return func(key K) []byte {
+		return append([]byte(prefix), encoder(key)...)
+	}
+}
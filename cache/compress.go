@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compression algorithms.
+const (
+	CompressionZstd   = "zstd"
+	CompressionSnappy = "snappy"
+)
+
+// value 头部的压缩标记.
+const (
+	compressnone byte = iota
+	compresszstd
+	compresssnappy
+)
+
+// ErrInvalidCompressedValue value 不是由 CompressCache 写入的.
+var ErrInvalidCompressedValue = errors.New("cache: invalid compressed value")
+
+// CompressCache 超过阈值的 value 压缩后写入后端.
+// value 头部保存一个字节的压缩标记, 读取时按标记解压, 修改压缩算法后旧数据仍然可以读取.
+type CompressCache struct {
+	valueCache
+	algorithm byte
+	threshold int
+	// encoder 写入需要压缩的 value 时才创建
+	encoderOnce sync.Once
+	encoder     *zstd.Encoder
+	encoderErr  error
+	// decoder 读取到 zstd 数据时才创建
+	decoderOnce sync.Once
+	decoder     *zstd.Decoder
+	decoderErr  error
+}
+
+// NewCompressCache new compress cache, 长度不小于 threshold 的 value 使用 algorithm 压缩.
+func NewCompressCache(c Cache, algorithm string, threshold int) (*CompressCache, error) {
+	cc := &CompressCache{threshold: threshold}
+	cc.valueCache = valueCache{cache: c, codec: cc}
+	switch algorithm {
+	case CompressionZstd:
+		cc.algorithm = compresszstd
+	case CompressionSnappy:
+		cc.algorithm = compresssnappy
+	default:
+		return nil, fmt.Errorf("cache: unsupported compression '%s'", algorithm)
+	}
+	return cc, nil
+}
+
+func (c *CompressCache) zstdEncoder() (*zstd.Encoder, error) {
+	c.encoderOnce.Do(func() {
+		c.encoder, c.encoderErr = zstd.NewWriter(nil)
+	})
+	return c.encoder, c.encoderErr
+}
+
+func (c *CompressCache) zstdDecoder() (*zstd.Decoder, error) {
+	c.decoderOnce.Do(func() {
+		c.decoder, c.decoderErr = zstd.NewReader(nil)
+	})
+	return c.decoder, c.decoderErr
+}
+
+func (c *CompressCache) encodeValue(_, value []byte) ([]byte, error) {
+	return c.encode(value)
+}
+
+func (c *CompressCache) decodeValue(_, data []byte) ([]byte, error) {
+	return c.decode(data)
+}
+
+func (c *CompressCache) encode(value []byte) ([]byte, error) {
+	if len(value) < c.threshold {
+		return append([]byte{compressnone}, value...), nil
+	}
+	switch c.algorithm {
+	case compresszstd:
+		encoder, err := c.zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(value, []byte{compresszstd}), nil
+	default:
+		return append([]byte{compresssnappy}, snappy.Encode(nil, value)...), nil
+	}
+}
+
+func (c *CompressCache) decode(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidCompressedValue
+	}
+	switch data[0] {
+	case compressnone:
+		return data[1:], nil
+	case compresszstd:
+		decoder, err := c.zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		value, err := decoder.DecodeAll(data[1:], nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCompressedValue, err)
+		}
+		return value, nil
+	case compresssnappy:
+		value, err := snappy.Decode(nil, data[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCompressedValue, err)
+		}
+		return value, nil
+	default:
+		return nil, ErrInvalidCompressedValue
+	}
+}
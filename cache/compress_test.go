@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mmtbak/microlibrary/config"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestCompressCache(t *testing.T) {
+	large := bytes.Repeat([]byte(`{"name":"alice","age":18}`), 100)
+	for _, algorithm := range []string{CompressionZstd, CompressionSnappy} {
+		backend := newTestMemoryCache(t, PolicyLRU, 100)
+		c, err := NewCompressCache(backend, algorithm, 64)
+		assert.Equal(t, err, nil)
+
+		assert.Equal(t, c.Set([]byte("small"), []byte("value"), time.Minute), nil)
+		assert.Equal(t, c.Set([]byte("large"), large, time.Minute), nil)
+		value, err := c.Get([]byte("small"))
+		assert.Equal(t, err, nil)
+		assert.Equal(t, value, []byte("value"))
+		value, err = c.Get([]byte("large"))
+		assert.Equal(t, err, nil)
+		assert.Equal(t, value, large)
+
+		raw, err := backend.Get([]byte("large"))
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(raw) < len(large)/10, true)
+		raw, err = backend.Get([]byte("small"))
+		assert.Equal(t, err, nil)
+		assert.Equal(t, raw, append([]byte{compressnone}, "value"...))
+
+		assert.Equal(t, backend.Set([]byte("invalid"), []byte{compresszstd, 1, 2, 3}, NoExpiration), nil)
+		_, err = c.Get([]byte("invalid"))
+		assert.NotEqual(t, err, nil)
+		assert.Equal(t, c.Delete([]byte("large")), true)
+	}
+
+	// 修改压缩算法后仍然可以读取旧数据
+	backend := newTestMemoryCache(t, PolicyLRU, 100)
+	zc, _ := NewCompressCache(backend, CompressionZstd, 0)
+	sc, _ := NewCompressCache(backend, CompressionSnappy, 0)
+	assert.Equal(t, zc.Set([]byte("key"), large, NoExpiration), nil)
+	value, err := sc.Get([]byte("key"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, value, large)
+
+	_, err = NewCompressCache(backend, "gzip", 0)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestNewCacheWithValueOptions(t *testing.T) {
+	c, err := NewCache(config.AccessPoint{
+		Source: "memory://localhost/?maxentries=100",
+		Options: map[string]any{
+			"Compression":       "zstd",
+			"CompressThreshold": 16,
+			"Encryption": map[string]any{
+				"ActiveKey": "k1",
+				"Keys":      map[string]any{"k1": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="},
+			},
+		},
+	})
+	assert.Equal(t, err, nil)
+	ec, ok := c.(*EncryptCache)
+	assert.Equal(t, ok, true)
+	_, ok = ec.Cache().(*CompressCache)
+	assert.Equal(t, ok, true)
+	testMultiCache(t, c)
+
+	_, err = NewCache(config.AccessPoint{
+		Source:  "memory://localhost/?maxentries=100",
+		Options: map[string]any{"Compression": "gzip"},
+	})
+	assert.NotEqual(t, err, nil)
+}
+
+func TestValueCacheForwarding(t *testing.T) {
+	// 快照在 Close 时保存
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	ap := config.AccessPoint{
+		Source:  "memory://localhost/?maxentries=100&snapshot=" + path,
+		Options: map[string]any{"Compression": "snappy"},
+	}
+	c, err := NewCache(ap)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, c.Set([]byte("key"), []byte("value"), time.Hour), nil)
+	assert.Equal(t, c.(interface{ Close() error }).Close(), nil)
+	c, err = NewCache(ap)
+	assert.Equal(t, err, nil)
+	value, err := c.Get([]byte("key"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, value, []byte("value"))
+
+	ic := c.(InspectCache)
+	assert.Equal(t, ic.Exists([]byte("key")), true)
+	ttl, err := ic.TTL([]byte("key"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ttl > 0, true)
+	stats, err := c.(StatsCache).Stats()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, stats.Entries, int64(1))
+	assert.Equal(t, ic.Clear(), nil)
+	assert.Equal(t, ic.Exists([]byte("key")), false)
+
+	// redis 后端保留原生 context
+	server := miniredis.RunT(t)
+	rc, err := NewContextCache(config.AccessPoint{
+		Source:  "redis://" + server.Addr() + "/0",
+		Options: map[string]any{"Compression": "zstd"},
+	})
+	assert.Equal(t, err, nil)
+	_, native := rc.(*nativeContextCache)
+	assert.Equal(t, native, true)
+	testContextCache(t, rc)
+
+	// 后端不支持的能力
+	cc, err := NewCompressCache(struct{ Cache }{newTestMemoryCache(t, PolicyLRU, 100)}, CompressionSnappy, 0)
+	assert.Equal(t, err, nil)
+	_, err = cc.Stats()
+	assert.Equal(t, errors.Is(err, ErrNotSupported), true)
+	assert.Equal(t, errors.Is(cc.Clear(), ErrNotSupported), true)
+	testMultiCache(t, cc)
+	assert.Equal(t, cc.Close(), nil)
+	assert.Equal(t, cc.decoder == nil && cc.encoder == nil, true)
+}
+
+func TestCompressCacheLazyZstd(t *testing.T) {
+	cc, err := NewCompressCache(newTestMemoryCache(t, PolicyLRU, 100), CompressionZstd, 16)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, cc.encoder == nil && cc.decoder == nil, true)
+
+	// 未达到阈值的 value 不创建 encoder
+	assert.Equal(t, cc.Set([]byte("small"), []byte("value"), 0), nil)
+	assert.Equal(t, cc.encoder == nil, true)
+
+	value := bytes.Repeat([]byte("value"), 10)
+	assert.Equal(t, cc.Set([]byte("large"), value, 0), nil)
+	assert.Equal(t, cc.encoder != nil, true)
+	v, err := cc.Get([]byte("large"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, v, value)
+}
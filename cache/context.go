@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/mmtbak/microlibrary/config"
+)
+
+// ContextCache context-first cache interface, 用于支持超时/取消和链路透传.
+// expiration 为 NoExpiration 时不过期, 为负数时返回 ErrInvalidExpiration.
+type ContextCache interface {
+	// set 填入key/value
+	Set(ctx context.Context, key, value []byte, expiration time.Duration) error
+	// get 根据key 查询value
+	Get(ctx context.Context, key []byte) (value []byte, err error)
+	// delete 删除key, 返回key是否存在
+	Delete(ctx context.Context, key []byte) (bool, error)
+	// Active 激活key ,刷新key的过期时间
+	Active(ctx context.Context, key []byte, expiration time.Duration) error
+}
+
+// contextBackend 原生支持 context 的后端, 例如 RedisCache.
+type contextBackend interface {
+	GetContext(ctx context.Context, key []byte) ([]byte, error)
+	SetContext(ctx context.Context, key, value []byte, expiration time.Duration) error
+	DeleteContext(ctx context.Context, key []byte) (bool, error)
+	ActiveContext(ctx context.Context, key []byte, expiration time.Duration) error
+}
+
+// NewContextCache new context cache, 参数与 NewCache 相同.
+func NewContextCache(conf config.AccessPoint) (ContextCache, error) {
+	c, err := NewCache(conf)
+	if err != nil {
+		return nil, err
+	}
+	return WithContext(c), nil
+}
+
+// WithContext 将 Cache 适配为 ContextCache.
+// 原生支持 context 的后端会将 ctx 传递到底层调用, 其它后端(如 FreeCache)只在调用前检查 ctx 是否已结束.
+func WithContext(c Cache) ContextCache {
+	if cc, ok := c.(*contextAdapter); ok {
+		return cc.cache
+	}
+	if backend, ok := c.(contextBackend); ok {
+		return &nativeContextCache{backend: backend}
+	}
+	return &localContextCache{cache: c}
+}
+
+// WithoutContext 将 ContextCache 适配为 Cache, 使用 context.Background() 调用.
+func WithoutContext(c ContextCache) Cache {
+	switch cc := c.(type) {
+	case *localContextCache:
+		return cc.cache
+	case *nativeContextCache:
+		if c, ok := cc.backend.(Cache); ok {
+			return c
+		}
+	}
+	return &contextAdapter{cache: c}
+}
+
+// nativeContextCache 原生支持 context 的后端.
+type nativeContextCache struct {
+	backend contextBackend
+}
+
+func (c *nativeContextCache) Get(ctx context.Context, key []byte) ([]byte, error) {
+	return c.backend.GetContext(ctx, key)
+}
+
+func (c *nativeContextCache) Set(ctx context.Context, key, value []byte, expiration time.Duration) error {
+	return c.backend.SetContext(ctx, key, value, expiration)
+}
+
+func (c *nativeContextCache) Delete(ctx context.Context, key []byte) (bool, error) {
+	return c.backend.DeleteContext(ctx, key)
+}
+
+func (c *nativeContextCache) Active(ctx context.Context, key []byte, expiration time.Duration) error {
+	return c.backend.ActiveContext(ctx, key, expiration)
+}
+
+// localContextCache 本地后端, 调用不会阻塞, 只在调用前检查 ctx.
+type localContextCache struct {
+	cache Cache
+}
+
+func (c *localContextCache) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.cache.Get(key)
+}
+
+func (c *localContextCache) Set(ctx context.Context, key, value []byte, expiration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.cache.Set(key, value, expiration)
+}
+
+func (c *localContextCache) Delete(ctx context.Context, key []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return c.cache.Delete(key), nil
+}
+
+func (c *localContextCache) Active(ctx context.Context, key []byte, expiration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.cache.Active(key, expiration)
+}
+
+// contextAdapter 将 ContextCache 适配为 Cache.
+type contextAdapter struct {
+	cache ContextCache
+}
+
+func (c *contextAdapter) Get(key []byte) ([]byte, error) {
+	return c.cache.Get(context.Background(), key)
+}
+
+func (c *contextAdapter) Set(key, value []byte, expiration time.Duration) error {
+	return c.cache.Set(context.Background(), key, value, expiration)
+}
+
+func (c *contextAdapter) Delete(key []byte) bool {
+	ok, _ := c.cache.Delete(context.Background(), key)
+	return ok
+}
+
+func (c *contextAdapter) Active(key []byte, expiration time.Duration) error {
+	return c.cache.Active(context.Background(), key, expiration)
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mmtbak/microlibrary/config"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func testContextCache(t *testing.T, c ContextCache) {
+	ctx := context.Background()
+	key := []byte("key")
+	assert.Equal(t, c.Set(ctx, key, []byte("value"), time.Minute), nil)
+	value, err := c.Get(ctx, key)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, value, []byte("value"))
+	assert.Equal(t, c.Active(ctx, key, time.Hour), nil)
+	ok, err := c.Delete(ctx, key)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ok, true)
+	_, err = c.Get(ctx, key)
+	assert.Equal(t, err, ErrNotFound)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = c.Get(canceled, key)
+	assert.Equal(t, errors.Is(err, context.Canceled), true)
+	err = c.Set(canceled, key, []byte("value"), time.Minute)
+	assert.Equal(t, errors.Is(err, context.Canceled), true)
+}
+
+func TestContextCache(t *testing.T) {
+	fc, err := NewContextCache(config.AccessPoint{Source: "freecache://localhost/"})
+	assert.Equal(t, err, nil)
+	testContextCache(t, fc)
+
+	server := miniredis.RunT(t)
+	rc, err := NewContextCache(config.AccessPoint{Source: "redis://" + server.Addr() + "/0"})
+	assert.Equal(t, err, nil)
+	_, native := rc.(*nativeContextCache)
+	assert.Equal(t, native, true)
+	testContextCache(t, rc)
+}
+
+func TestWithoutContext(t *testing.T) {
+	c := newTestMemoryCache(t, PolicyLRU, 100)
+	assert.Equal(t, WithoutContext(WithContext(c)), c)
+
+	wrapped := WithoutContext(Wrap(WithContext(c), MetricsMiddleware(func(Op, time.Duration, error) {})))
+	assert.Equal(t, wrapped.Set([]byte("key"), []byte("value"), NoExpiration), nil)
+	value, err := wrapped.Get([]byte("key"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, value, []byte("value"))
+	assert.Equal(t, wrapped.Delete([]byte("key")), true)
+	assert.Equal(t, WithContext(wrapped) != nil, true)
+}
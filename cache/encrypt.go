@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidEncryptedValue value 无法解密, 例如 key id 不存在或数据被篡改.
+var ErrInvalidEncryptedValue = errors.New("cache: invalid encrypted value")
+
+// EncryptionOptions 加密配置, 可以通过 AccessPoint.Options 的 Encryption 字段配置.
+type EncryptionOptions struct {
+	// ActiveKey 写入时使用的 key id
+	ActiveKey string
+	// Keys key id 到 base64 编码的 AES key(16/24/32 字节), 轮换时新增 key 并修改 ActiveKey, 旧 key 保留到旧数据过期
+	Keys map[string]string
+}
+
+// EncryptCache 使用 AES-GCM 加密 value 后写入后端, 缓存的 key 作为附加数据, value 不能被移动到其他 key 下.
+// value 格式: key id 长度, key id, nonce, 密文.
+// WriteSnapshot 读取时会解密, 因此不支持对 EncryptCache 做快照, 后端的快照(例如 memory 的 snapshot 参数)保存的是密文.
+type EncryptCache struct {
+	valueCache
+	activeid string
+	aeads    map[string]cipher.AEAD
+}
+
+// NewEncryptCache new encrypt cache, keys 为 key id 到 AES key 的映射.
+func NewEncryptCache(c Cache, keys map[string][]byte, activeid string) (*EncryptCache, error) {
+	if _, ok := keys[activeid]; !ok {
+		return nil, fmt.Errorf("cache: active encryption key '%s' not found", activeid)
+	}
+	ec := &EncryptCache{activeid: activeid, aeads: make(map[string]cipher.AEAD, len(keys))}
+	ec.valueCache = valueCache{cache: c, codec: ec}
+	for id, key := range keys {
+		if len(id) == 0 || len(id) > 255 {
+			return nil, fmt.Errorf("cache: invalid encryption key id '%s'", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("cache: invalid encryption key '%s': %w", id, err)
+		}
+		if ec.aeads[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return ec, nil
+}
+
+// NewEncryptCacheWithOptions new encrypt cache with base64 encoded keys.
+func NewEncryptCacheWithOptions(c Cache, options EncryptionOptions) (*EncryptCache, error) {
+	keys := make(map[string][]byte, len(options.Keys))
+	for id, encoded := range options.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("cache: invalid encryption key '%s': %w", id, err)
+		}
+		keys[id] = key
+	}
+	return NewEncryptCache(c, keys, options.ActiveKey)
+}
+
+// checkSnapshot 快照会写入明文, 不支持.
+func (c *EncryptCache) checkSnapshot() error {
+	return fmt.Errorf("%w: %T snapshot would write decrypted values", ErrNotSupported, c)
+}
+
+func (c *EncryptCache) encodeValue(key, value []byte) ([]byte, error) {
+	return c.encrypt(key, value)
+}
+
+func (c *EncryptCache) decodeValue(key, data []byte) ([]byte, error) {
+	return c.decrypt(key, data)
+}
+
+func (c *EncryptCache) encrypt(key, value []byte) ([]byte, error) {
+	aead := c.aeads[c.activeid]
+	data := make([]byte, 0, 1+len(c.activeid)+aead.NonceSize()+len(value)+aead.Overhead())
+	data = append(data, byte(len(c.activeid)))
+	data = append(data, c.activeid...)
+	nonce := data[len(data) : len(data)+aead.NonceSize()]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	data = data[:len(data)+aead.NonceSize()]
+	return aead.Seal(data, nonce, value, key), nil
+}
+
+func (c *EncryptCache) decrypt(key, data []byte) ([]byte, error) {
+	if len(data) == 0 || len(data) < 1+int(data[0]) {
+		return nil, ErrInvalidEncryptedValue
+	}
+	id := string(data[1 : 1+data[0]])
+	aead, ok := c.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id '%s'", ErrInvalidEncryptedValue, id)
+	}
+	data = data[1+len(id):]
+	if len(data) < aead.NonceSize() {
+		return nil, ErrInvalidEncryptedValue
+	}
+	value, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidEncryptedValue, err)
+	}
+	return value, nil
+}
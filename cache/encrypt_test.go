@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestEncryptCache(t *testing.T) {
+	backend := newTestMemoryCache(t, PolicyLRU, 100)
+	k1 := bytes.Repeat([]byte{1}, 32)
+	k2 := bytes.Repeat([]byte{2}, 16)
+	c, err := NewEncryptCache(backend, map[string][]byte{"k1": k1}, "k1")
+	assert.Equal(t, err, nil)
+
+	assert.Equal(t, c.Set([]byte("pii"), []byte("alice@example.com"), time.Minute), nil)
+	value, err := c.Get([]byte("pii"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, value, []byte("alice@example.com"))
+	raw, err := backend.Get([]byte("pii"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, bytes.Contains(raw, []byte("alice")), false)
+
+	// 密文不能移动到其他 key 下
+	assert.Equal(t, backend.Set([]byte("moved"), raw, NoExpiration), nil)
+	_, err = c.Get([]byte("moved"))
+	assert.Equal(t, errors.Is(err, ErrInvalidEncryptedValue), true)
+
+	// 轮换 key 后旧数据仍然可以读取, 新数据使用新 key
+	rotated, err := NewEncryptCache(backend, map[string][]byte{"k1": k1, "k2": k2}, "k2")
+	assert.Equal(t, err, nil)
+	value, err = rotated.Get([]byte("pii"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, value, []byte("alice@example.com"))
+	assert.Equal(t, rotated.Set([]byte("new"), []byte("bob"), time.Minute), nil)
+	_, err = c.Get([]byte("new"))
+	assert.Equal(t, errors.Is(err, ErrInvalidEncryptedValue), true)
+
+	_, err = NewEncryptCache(backend, map[string][]byte{"k1": k1}, "k2")
+	assert.NotEqual(t, err, nil)
+	_, err = NewEncryptCache(backend, map[string][]byte{"k1": []byte("short")}, "k1")
+	assert.NotEqual(t, err, nil)
+	_, err = NewEncryptCacheWithOptions(backend, EncryptionOptions{ActiveKey: "k1", Keys: map[string]string{"k1": "!"}})
+	assert.NotEqual(t, err, nil)
+}
+
+func TestEncryptCacheSnapshot(t *testing.T) {
+	backend := newTestMemoryCache(t, PolicyLRU, 100)
+	c, err := NewEncryptCache(backend, map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k1")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, c.Set([]byte("pii"), []byte("alice@example.com"), time.Minute), nil)
+
+	// 快照会写入明文, 包装后同样拒绝
+	var buf bytes.Buffer
+	_, err = WriteSnapshot(c, &buf)
+	assert.Equal(t, errors.Is(err, ErrNotSupported), true)
+	cc, err := NewCompressCache(c, CompressionSnappy, 0)
+	assert.Equal(t, err, nil)
+	_, err = WriteSnapshot(cc, &buf)
+	assert.Equal(t, errors.Is(err, ErrNotSupported), true)
+	assert.Equal(t, buf.Len(), 0)
+
+	// 后端的快照保存密文
+	count, err := WriteSnapshot(backend, &buf)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, count, 1)
+	assert.Equal(t, bytes.Contains(buf.Bytes(), []byte("alice")), false)
+}
@@ -0,0 +1,22 @@
+package cache
+
+import "errors"
+
+// 与后端无关的错误, 每个后端都会将自身的错误映射为以下错误, 调用方使用 errors.Is 判断.
+var (
+	// ErrNotFound key不存在或已过期
+	ErrNotFound = errors.New("cache: entry not found")
+	// ErrTooLarge key或value超过后端限制
+	ErrTooLarge = errors.New("cache: entry too large")
+	// ErrUnavailable 后端不可用, 例如网络错误或连接池耗尽
+	ErrUnavailable = errors.New("cache: backend unavailable")
+	// ErrInvalidExpiration 过期时间为负数
+	ErrInvalidExpiration = errors.New("cache: invalid expiration")
+	// ErrNotSupported 后端不支持该操作
+	ErrNotSupported = errors.New("cache: operation not supported")
+)
+
+// IsErrNotFound return true if the error is a not found error
+func IsErrNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
@@ -1,6 +1,9 @@
 package cache
 
 import (
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -11,10 +14,16 @@ import (
 // default sizeKB 10MB.
 const defaultcachesizekb = 10 * 1024
 
+// deadlinesize value 头部保存过期时间(unix nano)的长度.
+const deadlinesize = 8
+
 // FreeCache set.
+// freecache 的过期时间精度为秒, 因此在 value 头部保存纳秒精度的过期时间, 读取时校验;
+// freecache 自身的过期时间向上取整到秒, 只用于回收空间.
 type FreeCache struct {
-	cache  *freecache.Cache
-	params freecacheParam
+	cache    *freecache.Cache
+	params   freecacheParam
+	snapshot *snapshotter
 }
 
 type freecacheParam struct {
@@ -22,6 +31,7 @@ type freecacheParam struct {
 }
 
 // NewFreecache free cache.
+// freecache://localhost/?sizekb=1024&snapshot=/path/to/file&snapshotinterval=5m
 func NewFreecache(conf config.AccessPoint) (*FreeCache, error) {
 	var err error
 	param := freecacheParam{
@@ -37,17 +47,33 @@ func NewFreecache(conf config.AccessPoint) (*FreeCache, error) {
 		}
 	}
 	cache := freecache.NewCache(param.SizeKB * 1024)
-	return &FreeCache{cache: cache, params: param}, nil
+	c := &FreeCache{cache: cache, params: param}
+	if c.snapshot, err = newSnapshotter(c, params); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close 配置了快照时保存快照.
+func (c *FreeCache) Close() error {
+	return c.snapshot.close()
 }
 
 // Get key to cache.
 func (c *FreeCache) Get(key []byte) (value []byte, err error) {
-	return c.cache.Get(key)
+	data, err := c.cache.Get(key)
+	if err != nil {
+		return nil, freecacheError(err)
+	}
+	return c.decode(key, data)
 }
 
-// Set key to cache.
+// Set key to cache, expiration 为 NoExpiration 时不过期.
 func (c *FreeCache) Set(key, value []byte, expiration time.Duration) error {
-	return c.cache.Set(key, value, int(expiration.Seconds()))
+	if err := checkExpiration(expiration); err != nil {
+		return err
+	}
+	return freecacheError(c.cache.Set(key, encodeDeadline(value, expiration), expireSeconds(expiration)))
 }
 
 // Delete key to cache.
@@ -57,5 +83,180 @@ func (c *FreeCache) Delete(key []byte) bool {
 
 // Active key to cache.
 func (c *FreeCache) Active(key []byte, expiration time.Duration) error {
-	return c.cache.Touch(key, int(expiration.Seconds()))
+	if err := checkExpiration(expiration); err != nil {
+		return err
+	}
+	var replaced bool
+	_, _, err := c.cache.Update(key, func(data []byte, found bool) ([]byte, bool, int) {
+		// 已过期的key不会被替换
+		if !found || expired(data) {
+			return nil, false, 0
+		}
+		replaced = true
+		return encodeDeadline(data[deadlinesize:], expiration), true, expireSeconds(expiration)
+	})
+	if err != nil {
+		return freecacheError(err)
+	}
+	if !replaced {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// decode 校验过期时间并去掉头部, 过期的key会被删除.
+func (c *FreeCache) decode(key, data []byte) ([]byte, error) {
+	if len(data) < deadlinesize {
+		return nil, ErrNotFound
+	}
+	if expired(data) {
+		c.cache.Del(key)
+		return nil, ErrNotFound
+	}
+	return data[deadlinesize:], nil
+}
+
+// encodeDeadline value 头部增加过期时间.
+func encodeDeadline(value []byte, expiration time.Duration) []byte {
+	var deadline int64
+	if expiration > 0 {
+		deadline = time.Now().Add(expiration).UnixNano()
+	}
+	data := make([]byte, deadlinesize, deadlinesize+len(value))
+	binary.BigEndian.PutUint64(data, uint64(deadline))
+	return append(data, value...)
+}
+
+// deadlineOf 头部的过期时间, 0 表示不过期.
+func deadlineOf(data []byte) int64 {
+	if len(data) < deadlinesize {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(data[:deadlinesize]))
+}
+
+func expired(data []byte) bool {
+	deadline := deadlineOf(data)
+	return deadline != 0 && time.Now().UnixNano() >= deadline
+}
+
+// expireSeconds freecache 的过期秒数, 向上取整保证不早于真实的过期时间.
+func expireSeconds(expiration time.Duration) int {
+	if expiration <= 0 {
+		return 0
+	}
+	return int((expiration + time.Second - 1) / time.Second)
+}
+
+// freecacheError 将 freecache 的错误映射为包内错误.
+func freecacheError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, freecache.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, freecache.ErrLargeKey), errors.Is(err, freecache.ErrLargeEntry):
+		return fmt.Errorf("%w: %w", ErrTooLarge, err)
+	}
+	return err
+}
+
+// MGet keys from cache.
+func (c *FreeCache) MGet(keys [][]byte) []Result {
+	results := make([]Result, len(keys))
+	for idx, key := range keys {
+		results[idx].Key = key
+		results[idx].Value, results[idx].Err = c.Get(key)
+	}
+	return results
+}
+
+// MSet keys to cache.
+func (c *FreeCache) MSet(items []Item) []error {
+	errs := make([]error, len(items))
+	for idx, item := range items {
+		errs[idx] = c.Set(item.Key, item.Value, item.Expiration)
+	}
+	return errs
+}
+
+// MDelete keys from cache.
+func (c *FreeCache) MDelete(keys [][]byte) []bool {
+	deleted := make([]bool, len(keys))
+	for idx, key := range keys {
+		deleted[idx] = c.cache.Del(key)
+	}
+	return deleted
+}
+
+// Stats cache statistics.
+func (c *FreeCache) Stats() (Stats, error) {
+	stats := Stats{
+		Hits:        c.cache.HitCount(),
+		Misses:      c.cache.MissCount(),
+		Entries:     c.cache.EntryCount(),
+		Evictions:   c.cache.EvacuateCount(),
+		Expirations: c.cache.ExpiredCount(),
+	}
+	stats.HitRate = hitRate(stats.Hits, stats.Misses)
+	iter := c.cache.NewIterator()
+	for entry := iter.Next(); entry != nil; entry = iter.Next() {
+		stats.BytesUsed += int64(len(entry.Key) + len(entry.Value) - deadlinesize)
+	}
+	return stats, nil
+}
+
+// TTL time left of key.
+func (c *FreeCache) TTL(key []byte) (time.Duration, error) {
+	data, err := c.cache.Peek(key)
+	if err != nil {
+		return 0, freecacheError(err)
+	}
+	deadline := deadlineOf(data)
+	if deadline == 0 {
+		return 0, nil
+	}
+	left := time.Until(time.Unix(0, deadline))
+	if left <= 0 {
+		return 0, ErrNotFound
+	}
+	return left, nil
+}
+
+// peek 读取 value 和过期时间, 不更新命中统计.
+func (c *FreeCache) peek(key []byte) ([]byte, int64, error) {
+	data, err := c.cache.Peek(key)
+	if err != nil {
+		return nil, 0, freecacheError(err)
+	}
+	if len(data) < deadlinesize || expired(data) {
+		return nil, 0, ErrNotFound
+	}
+	return data[deadlinesize:], deadlineOf(data), nil
+}
+
+// Exists key in cache.
+func (c *FreeCache) Exists(key []byte) bool {
+	data, err := c.cache.Peek(key)
+	return err == nil && !expired(data)
+}
+
+// Clear all keys.
+func (c *FreeCache) Clear() error {
+	c.cache.Clear()
+	return nil
+}
+
+// Range keys in cache.
+func (c *FreeCache) Range(fn func(key []byte) bool) error {
+	iter := c.cache.NewIterator()
+	for entry := iter.Next(); entry != nil; entry = iter.Next() {
+		if expired(entry.Value) {
+			continue
+		}
+		if !fn(entry.Key) {
+			break
+		}
+	}
+	return nil
 }
@@ -2,10 +2,10 @@ package cache
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 	"time"
 
-	"github.com/coocood/freecache"
 	"github.com/mmtbak/microlibrary/config"
 	"gopkg.in/go-playground/assert.v1"
 )
@@ -28,6 +28,47 @@ func TestFreecache(t *testing.T) {
 	c.Active(key, expireduration)
 	time.Sleep(2 * time.Second)
 	v, err = c.Get(key)
-	assert.Equal(t, err, freecache.ErrNotFound)
+	assert.Equal(t, err, ErrNotFound)
 	assert.Equal(t, bytes.Equal(v, value), false)
 }
+
+func TestFreecacheErrors(t *testing.T) {
+	conf := config.AccessPoint{
+		Source: "freecache://localhost/?sizekb=1000",
+	}
+	c, err := NewFreecache(conf)
+	assert.Equal(t, err, nil)
+	// value 超过 cache 大小的 1/1024
+	err = c.Set([]byte("key1"), make([]byte, 1000*1024), 0)
+	assert.Equal(t, errors.Is(err, ErrTooLarge), true)
+	_, err = c.Get([]byte("key1"))
+	assert.Equal(t, IsErrNotFound(err), true)
+}
+
+func TestFreecacheSubSecondExpiration(t *testing.T) {
+	c, err := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?sizekb=1000"})
+	assert.Equal(t, err, nil)
+	key := []byte("key1")
+
+	err = c.Set(key, []byte("value1"), 200*time.Millisecond)
+	assert.Equal(t, err, nil)
+	v, err := c.Get(key)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(v), "value1")
+	time.Sleep(250 * time.Millisecond)
+	_, err = c.Get(key)
+	assert.Equal(t, IsErrNotFound(err), true)
+	assert.Equal(t, c.Active(key, time.Second), ErrNotFound)
+
+	err = c.Set(key, []byte("value1"), NoExpiration)
+	assert.Equal(t, err, nil)
+	err = c.Active(key, 100*time.Millisecond)
+	assert.Equal(t, err, nil)
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, c.Exists(key), false)
+
+	err = c.Set(key, []byte("value1"), -time.Second)
+	assert.Equal(t, errors.Is(err, ErrInvalidExpiration), true)
+	err = c.Active(key, -time.Second)
+	assert.Equal(t, errors.Is(err, ErrInvalidExpiration), true)
+}
@@ -0,0 +1,402 @@
+package cache
+
+import (
+	"fmt"
+	"hash/maphash"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mmtbak/microlibrary/config"
+)
+
+// default memory cache shards.
+const defaultmemoryshards = 16
+
+// EvictReason 淘汰原因.
+type EvictReason int
+
+const (
+	// EvictCapacity 超过容量被淘汰
+	EvictCapacity EvictReason = iota
+	// EvictExpired 过期被删除
+	EvictExpired
+)
+
+// EvictFunc 淘汰回调, 在锁外调用.
+type EvictFunc func(key, value []byte, reason EvictReason)
+
+// MemoryCache 纯 Go 实现的进程内缓存, 支持 LRU/LFU/ARC/W-TinyLFU 淘汰策略,
+// 按条目数或字节数限制容量, 按key哈希分片加锁.
+// 与 freecache 不同, 单个value的大小只受分片容量限制.
+type MemoryCache struct {
+	shards   []*memoryShard
+	seed     maphash.Seed
+	onEvict  EvictFunc
+	params   memoryParam
+	snapshot *snapshotter
+}
+
+type memoryParam struct {
+	Policy     string
+	MaxEntries int
+	MaxBytes   int64
+	Shards     int
+}
+
+var memoryParamFuncs = map[string]func(*memoryParam, string) error{
+	"policy": func(param *memoryParam, val string) error {
+		param.Policy = val
+		return nil
+	},
+	"maxentries": func(param *memoryParam, val string) error {
+		var err error
+		param.MaxEntries, err = strconv.Atoi(val)
+		return err
+	},
+	"maxbytes": func(param *memoryParam, val string) error {
+		var err error
+		param.MaxBytes, err = strconv.ParseInt(val, 10, 64)
+		return err
+	},
+	"shards": func(param *memoryParam, val string) error {
+		var err error
+		param.Shards, err = strconv.Atoi(val)
+		return err
+	},
+}
+
+type memoryEntry struct {
+	value    []byte
+	deadline int64 // unix nano, 0 表示不过期
+}
+
+func (e *memoryEntry) expired(now int64) bool {
+	return e.deadline != 0 && now >= e.deadline
+}
+
+type memoryShard struct {
+	mutex      sync.Mutex
+	items      map[string]*memoryEntry
+	policy     evictionPolicy
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+	stats      Stats
+}
+
+type evicted struct {
+	key    string
+	value  []byte
+	reason EvictReason
+}
+
+// NewMemoryCache new memory cache.
+// memory://localhost/?policy=lru&maxentries=10000&maxbytes=10485760&shards=16&snapshot=/path/to/file
+// policy: lru, lfu, arc, tinylfu; maxentries 和 maxbytes 至少设置一个, 同时设置时都生效.
+func NewMemoryCache(conf config.AccessPoint) (*MemoryCache, error) {
+	var err error
+	param := memoryParam{
+		Policy: defaultPolicy,
+		Shards: defaultmemoryshards,
+	}
+	params := conf.Decode().Params
+	err = config.ParseMapStringConfig(&param, params, memoryParamFuncs)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewMemoryCacheWithParam(param.Policy, param.MaxEntries, param.MaxBytes, param.Shards)
+	if err != nil {
+		return nil, err
+	}
+	if c.snapshot, err = newSnapshotter(c, params); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close 配置了快照时保存快照.
+func (c *MemoryCache) Close() error {
+	return c.snapshot.close()
+}
+
+// NewMemoryCacheWithParam new memory cache.
+func NewMemoryCacheWithParam(policy string, maxEntries int, maxBytes int64, shards int) (*MemoryCache, error) {
+	if maxEntries <= 0 && maxBytes <= 0 {
+		return nil, fmt.Errorf("cache: memory cache requires maxentries or maxbytes")
+	}
+	if shards <= 0 {
+		shards = defaultmemoryshards
+	}
+	// 容量太小时减少分片数, 保证每个分片至少一个条目
+	if maxEntries > 0 && maxEntries < shards {
+		shards = maxEntries
+	}
+	c := &MemoryCache{
+		shards: make([]*memoryShard, shards),
+		seed:   maphash.MakeSeed(),
+		params: memoryParam{Policy: policy, MaxEntries: maxEntries, MaxBytes: maxBytes, Shards: shards},
+	}
+	for idx := range c.shards {
+		shard := &memoryShard{
+			items:      make(map[string]*memoryEntry),
+			maxEntries: maxEntries / shards,
+			maxBytes:   maxBytes / int64(shards),
+		}
+		var ok bool
+		shard.policy, ok = newEvictionPolicy(policy, shard.maxEntries)
+		if !ok {
+			return nil, fmt.Errorf("cache: unsupported eviction policy '%s'", policy)
+		}
+		c.shards[idx] = shard
+	}
+	return c, nil
+}
+
+// WithEvictFunc set evict callback.
+func (c *MemoryCache) WithEvictFunc(f EvictFunc) *MemoryCache {
+	c.onEvict = f
+	return c
+}
+
+func (c *MemoryCache) shard(key string) *memoryShard {
+	return c.shards[maphash.String(c.seed, key)%uint64(len(c.shards))]
+}
+
+func (c *MemoryCache) notify(items []evicted) {
+	if c.onEvict == nil {
+		return
+	}
+	for _, item := range items {
+		c.onEvict([]byte(item.key), item.value, item.reason)
+	}
+}
+
+// Get key from cache.
+func (c *MemoryCache) Get(key []byte) (value []byte, err error) {
+	k := string(key)
+	s := c.shard(k)
+	var removed []evicted
+	s.mutex.Lock()
+	entry, ok := s.items[k]
+	if ok && entry.expired(time.Now().UnixNano()) {
+		removed = append(removed, s.remove(k, EvictExpired))
+		ok = false
+	}
+	if ok {
+		s.policy.access(k)
+		s.stats.Hits++
+		value = append([]byte(nil), entry.value...)
+	} else {
+		s.stats.Misses++
+	}
+	s.mutex.Unlock()
+	c.notify(removed)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+// Set key to cache.
+func (c *MemoryCache) Set(key, value []byte, expiration time.Duration) error {
+	if err := checkExpiration(expiration); err != nil {
+		return err
+	}
+	k := string(key)
+	s := c.shard(k)
+	size := int64(len(k) + len(value))
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return fmt.Errorf("%w: entry size %d exceeds shard capacity %d", ErrTooLarge, size, s.maxBytes)
+	}
+	entry := &memoryEntry{value: append([]byte(nil), value...)}
+	if expiration > 0 {
+		entry.deadline = time.Now().Add(expiration).UnixNano()
+	}
+
+	s.mutex.Lock()
+	if old, ok := s.items[k]; ok {
+		s.bytes -= int64(len(k) + len(old.value))
+		s.policy.access(k)
+	} else {
+		s.policy.add(k)
+	}
+	s.items[k] = entry
+	s.bytes += size
+	removed := s.evict(k)
+	s.mutex.Unlock()
+	c.notify(removed)
+	return nil
+}
+
+// Delete key from cache.
+func (c *MemoryCache) Delete(key []byte) bool {
+	k := string(key)
+	s := c.shard(k)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.items[k]
+	if !ok {
+		return false
+	}
+	s.remove(k, EvictExpired)
+	return !entry.expired(time.Now().UnixNano())
+}
+
+// Active key in cache.
+func (c *MemoryCache) Active(key []byte, expiration time.Duration) error {
+	if err := checkExpiration(expiration); err != nil {
+		return err
+	}
+	k := string(key)
+	s := c.shard(k)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.items[k]
+	if !ok || entry.expired(time.Now().UnixNano()) {
+		return ErrNotFound
+	}
+	entry.deadline = 0
+	if expiration > 0 {
+		entry.deadline = time.Now().Add(expiration).UnixNano()
+	}
+	return nil
+}
+
+// Stats cache statistics.
+func (c *MemoryCache) Stats() (Stats, error) {
+	var stats Stats
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		stats.Hits += s.stats.Hits
+		stats.Misses += s.stats.Misses
+		stats.Evictions += s.stats.Evictions
+		stats.Expirations += s.stats.Expirations
+		stats.Entries += int64(len(s.items))
+		stats.BytesUsed += s.bytes
+		s.mutex.Unlock()
+	}
+	stats.HitRate = hitRate(stats.Hits, stats.Misses)
+	return stats, nil
+}
+
+// TTL time left of key.
+func (c *MemoryCache) TTL(key []byte) (time.Duration, error) {
+	k := string(key)
+	s := c.shard(k)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.items[k]
+	if !ok || entry.expired(time.Now().UnixNano()) {
+		return 0, ErrNotFound
+	}
+	if entry.deadline == 0 {
+		return 0, nil
+	}
+	return time.Until(time.Unix(0, entry.deadline)), nil
+}
+
+// peek 读取 value 和过期时间, 不更新命中统计和淘汰顺序.
+func (c *MemoryCache) peek(key []byte) ([]byte, int64, error) {
+	k := string(key)
+	s := c.shard(k)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.items[k]
+	if !ok || entry.expired(time.Now().UnixNano()) {
+		return nil, 0, ErrNotFound
+	}
+	return append([]byte(nil), entry.value...), entry.deadline, nil
+}
+
+// Exists key in cache.
+func (c *MemoryCache) Exists(key []byte) bool {
+	k := string(key)
+	s := c.shard(k)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.items[k]
+	return ok && !entry.expired(time.Now().UnixNano())
+}
+
+// Clear all keys.
+func (c *MemoryCache) Clear() error {
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		policy, _ := newEvictionPolicy(c.params.Policy, s.maxEntries)
+		s.items = make(map[string]*memoryEntry)
+		s.policy = policy
+		s.bytes = 0
+		s.mutex.Unlock()
+	}
+	return nil
+}
+
+// Range keys in cache, 遍历时按分片复制key, 不阻塞写入.
+func (c *MemoryCache) Range(fn func(key []byte) bool) error {
+	for _, s := range c.shards {
+		now := time.Now().UnixNano()
+		s.mutex.Lock()
+		keys := make([]string, 0, len(s.items))
+		for k, entry := range s.items {
+			if !entry.expired(now) {
+				keys = append(keys, k)
+			}
+		}
+		s.mutex.Unlock()
+		for _, k := range keys {
+			if !fn([]byte(k)) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteExpired 删除所有已过期的key.
+func (c *MemoryCache) DeleteExpired() {
+	for _, s := range c.shards {
+		now := time.Now().UnixNano()
+		var removed []evicted
+		s.mutex.Lock()
+		for k, entry := range s.items {
+			if entry.expired(now) {
+				removed = append(removed, s.remove(k, EvictExpired))
+			}
+		}
+		s.mutex.Unlock()
+		c.notify(removed)
+	}
+}
+
+// remove 删除key, 调用方持有锁.
+func (s *memoryShard) remove(key string, reason EvictReason) evicted {
+	entry := s.items[key]
+	delete(s.items, key)
+	s.policy.remove(key)
+	s.bytes -= int64(len(key) + len(entry.value))
+	if reason == EvictExpired && entry.expired(time.Now().UnixNano()) {
+		s.stats.Expirations++
+	}
+	return evicted{key: key, value: entry.value, reason: reason}
+}
+
+// evict 超过容量时按策略淘汰, 优先不淘汰刚写入的 protect, 调用方持有锁.
+func (s *memoryShard) evict(protect string) []evicted {
+	var removed []evicted
+	for (s.maxEntries > 0 && len(s.items) > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		key, ok := s.policy.victim(protect)
+		if !ok {
+			break
+		}
+		entry, exists := s.items[key]
+		if !exists {
+			continue
+		}
+		delete(s.items, key)
+		s.bytes -= int64(len(key) + len(entry.value))
+		s.stats.Evictions++
+		removed = append(removed, evicted{key: key, value: entry.value, reason: EvictCapacity})
+	}
+	return removed
+}
@@ -0,0 +1,489 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+)
+
+// 淘汰策略.
+const (
+	PolicyLRU      = "lru"
+	PolicyLFU      = "lfu"
+	PolicyARC      = "arc"
+	PolicyTinyLFU  = "tinylfu" // W-TinyLFU
+	defaultPolicy  = PolicyLRU
+	sketchMinWidth = 1024
+)
+
+// evictionPolicy 淘汰策略, 只维护key的顺序, 不保存value, 由 memoryShard 加锁调用.
+type evictionPolicy interface {
+	// add 新增key
+	add(key string)
+	// access 命中或更新key
+	access(key string)
+	// remove 删除key
+	remove(key string)
+	// victim 选出需要淘汰的key, 尽量不选择 protect, 没有可淘汰的key时返回false
+	victim(protect string) (string, bool)
+}
+
+// newEvictionPolicy capacity 为分片的容量(条目数), 按字节限制容量时为0, 由策略根据当前条目数估算.
+func newEvictionPolicy(name string, capacity int) (evictionPolicy, bool) {
+	switch name {
+	case PolicyLRU:
+		return newLRUPolicy(), true
+	case PolicyLFU:
+		return newLFUPolicy(), true
+	case PolicyARC:
+		return newARCPolicy(capacity), true
+	case PolicyTinyLFU:
+		return newTinyLFUPolicy(capacity), true
+	}
+	return nil, false
+}
+
+// lruList 带索引的 LRU 链表, front 为最近使用.
+type lruList struct {
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newLRUList() *lruList {
+	return &lruList{ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *lruList) len() int {
+	return l.ll.Len()
+}
+
+func (l *lruList) contains(key string) bool {
+	_, ok := l.items[key]
+	return ok
+}
+
+func (l *lruList) pushFront(key string) {
+	if elem, ok := l.items[key]; ok {
+		l.ll.MoveToFront(elem)
+		return
+	}
+	l.items[key] = l.ll.PushFront(key)
+}
+
+func (l *lruList) remove(key string) bool {
+	elem, ok := l.items[key]
+	if !ok {
+		return false
+	}
+	l.ll.Remove(elem)
+	delete(l.items, key)
+	return true
+}
+
+// back 最久未使用的key, 跳过 protect.
+func (l *lruList) back(protect string) (string, bool) {
+	for elem := l.ll.Back(); elem != nil; elem = elem.Prev() {
+		if key := elem.Value.(string); key != protect {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// popBack 删除最久未使用的key.
+func (l *lruList) popBack() (string, bool) {
+	elem := l.ll.Back()
+	if elem == nil {
+		return "", false
+	}
+	key := elem.Value.(string)
+	l.ll.Remove(elem)
+	delete(l.items, key)
+	return key, true
+}
+
+// lruPolicy 最近最少使用.
+type lruPolicy struct {
+	lru *lruList
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{lru: newLRUList()}
+}
+
+func (p *lruPolicy) add(key string)    { p.lru.pushFront(key) }
+func (p *lruPolicy) access(key string) { p.lru.pushFront(key) }
+func (p *lruPolicy) remove(key string) { p.lru.remove(key) }
+
+func (p *lruPolicy) victim(protect string) (string, bool) {
+	key, ok := p.lru.back(protect)
+	if !ok {
+		key, ok = p.lru.back("")
+	}
+	if ok {
+		p.lru.remove(key)
+	}
+	return key, ok
+}
+
+// lfuPolicy 最不经常使用, 相同频率时淘汰最久未使用的key.
+type lfuPolicy struct {
+	freqs   map[string]int
+	buckets map[int]*lruList
+	minFreq int
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{freqs: make(map[string]int), buckets: make(map[int]*lruList)}
+}
+
+func (p *lfuPolicy) bucket(freq int) *lruList {
+	b, ok := p.buckets[freq]
+	if !ok {
+		b = newLRUList()
+		p.buckets[freq] = b
+	}
+	return b
+}
+
+func (p *lfuPolicy) add(key string) {
+	if _, ok := p.freqs[key]; ok {
+		p.access(key)
+		return
+	}
+	p.freqs[key] = 1
+	p.bucket(1).pushFront(key)
+	p.minFreq = 1
+}
+
+func (p *lfuPolicy) access(key string) {
+	freq, ok := p.freqs[key]
+	if !ok {
+		return
+	}
+	p.detach(key, freq)
+	p.freqs[key] = freq + 1
+	p.bucket(freq + 1).pushFront(key)
+	if p.minFreq == freq && p.buckets[freq] == nil {
+		p.minFreq = freq + 1
+	}
+}
+
+func (p *lfuPolicy) remove(key string) {
+	freq, ok := p.freqs[key]
+	if !ok {
+		return
+	}
+	p.detach(key, freq)
+	delete(p.freqs, key)
+	if p.minFreq == freq && p.buckets[freq] == nil {
+		p.resetMinFreq()
+	}
+}
+
+func (p *lfuPolicy) detach(key string, freq int) {
+	b := p.buckets[freq]
+	b.remove(key)
+	if b.len() == 0 {
+		delete(p.buckets, freq)
+	}
+}
+
+func (p *lfuPolicy) resetMinFreq() {
+	p.minFreq = 0
+	for freq := range p.buckets {
+		if p.minFreq == 0 || freq < p.minFreq {
+			p.minFreq = freq
+		}
+	}
+}
+
+func (p *lfuPolicy) victim(protect string) (string, bool) {
+	if len(p.freqs) == 0 {
+		return "", false
+	}
+	key, ok := p.buckets[p.minFreq].back(protect)
+	if !ok {
+		// 最低频率中只有 protect, 从其他频率中选择
+		for freq, b := range p.buckets {
+			if freq == p.minFreq {
+				continue
+			}
+			if key, ok = b.back(protect); ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		key = protect
+	}
+	p.remove(key)
+	return key, true
+}
+
+// arcPolicy 自适应替换缓存, t1/t2 为最近/频繁使用的key, b1/b2 为对应被淘汰的幽灵key.
+type arcPolicy struct {
+	capacity int
+	p        int
+	t1, t2   *lruList
+	b1, b2   *lruList
+	// ghostB2 最近一次新增的key命中b2
+	ghostB2 bool
+}
+
+func newARCPolicy(capacity int) *arcPolicy {
+	return &arcPolicy{
+		capacity: capacity,
+		t1:       newLRUList(),
+		t2:       newLRUList(),
+		b1:       newLRUList(),
+		b2:       newLRUList(),
+	}
+}
+
+// size 目标容量, 按字节限制容量时使用当前条目数.
+func (p *arcPolicy) size() int {
+	if p.capacity > 0 {
+		return p.capacity
+	}
+	return max(p.t1.len()+p.t2.len(), 1)
+}
+
+func (p *arcPolicy) add(key string) {
+	if p.t1.contains(key) || p.t2.contains(key) {
+		p.access(key)
+		return
+	}
+	p.ghostB2 = false
+	switch {
+	case p.b1.contains(key):
+		p.p = min(p.p+max(p.b2.len()/max(p.b1.len(), 1), 1), p.size())
+		p.b1.remove(key)
+		p.t2.pushFront(key)
+	case p.b2.contains(key):
+		p.p = max(p.p-max(p.b1.len()/max(p.b2.len(), 1), 1), 0)
+		p.b2.remove(key)
+		p.t2.pushFront(key)
+		p.ghostB2 = true
+	default:
+		p.t1.pushFront(key)
+	}
+}
+
+func (p *arcPolicy) access(key string) {
+	if p.t1.remove(key) || p.t2.contains(key) {
+		p.t2.pushFront(key)
+	}
+}
+
+func (p *arcPolicy) remove(key string) {
+	if !p.t1.remove(key) {
+		p.t2.remove(key)
+	}
+}
+
+func (p *arcPolicy) victim(protect string) (string, bool) {
+	t1len := p.t1.len()
+	if p.t1.contains(protect) {
+		t1len--
+	}
+	fromT1 := t1len > 0 && (p.t1.len() > p.p || (p.ghostB2 && p.t1.len() == p.p))
+	var key string
+	var ok bool
+	if fromT1 {
+		if key, ok = p.t1.back(protect); ok {
+			p.t1.remove(key)
+			p.b1.pushFront(key)
+		}
+	}
+	if !ok {
+		if key, ok = p.t2.back(protect); ok {
+			p.t2.remove(key)
+			p.b2.pushFront(key)
+		}
+	}
+	if !ok {
+		if key, ok = p.t1.back(""); ok {
+			p.t1.remove(key)
+			p.b1.pushFront(key)
+		}
+	}
+	// 幽灵列表不超过目标容量
+	for p.b1.len() > p.size() {
+		p.b1.popBack()
+	}
+	for p.b2.len() > p.size() {
+		p.b2.popBack()
+	}
+	return key, ok
+}
+
+// tinyLFUPolicy W-TinyLFU: 新key先进入窗口LRU, 窗口溢出的key进入主区probation成为候选,
+// 需要淘汰时候选与probation中最久未使用的key比较访问频率, 频率低的被淘汰.
+// 主区为分段LRU, probation 中再次命中的key晋升到 protected.
+type tinyLFUPolicy struct {
+	capacity  int
+	window    *lruList
+	probation *lruList
+	protected *lruList
+	sketch    *countMinSketch
+	// candidate 最近从窗口进入probation, 尚未经过准入比较的key
+	candidate string
+}
+
+func newTinyLFUPolicy(capacity int) *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		capacity:  capacity,
+		window:    newLRUList(),
+		probation: newLRUList(),
+		protected: newLRUList(),
+		sketch:    newCountMinSketch(capacity),
+	}
+}
+
+func (p *tinyLFUPolicy) size() int {
+	if p.capacity > 0 {
+		return p.capacity
+	}
+	return max(p.window.len()+p.probation.len()+p.protected.len(), 1)
+}
+
+// windowMax 窗口占1%, protectedMax 占主区的80%.
+func (p *tinyLFUPolicy) windowMax() int {
+	return max(p.size()/100, 1)
+}
+
+func (p *tinyLFUPolicy) protectedMax() int {
+	return max((p.size()-p.windowMax())*8/10, 1)
+}
+
+func (p *tinyLFUPolicy) add(key string) {
+	p.sketch.increment(key)
+	if p.window.contains(key) || p.probation.contains(key) || p.protected.contains(key) {
+		p.touch(key)
+		return
+	}
+	p.window.pushFront(key)
+	for p.window.len() > p.windowMax() {
+		moved, _ := p.window.popBack()
+		p.probation.pushFront(moved)
+		p.candidate = moved
+	}
+}
+
+func (p *tinyLFUPolicy) access(key string) {
+	p.sketch.increment(key)
+	p.touch(key)
+}
+
+func (p *tinyLFUPolicy) touch(key string) {
+	switch {
+	case p.window.contains(key):
+		p.window.pushFront(key)
+	case p.probation.remove(key):
+		p.protected.pushFront(key)
+		for p.protected.len() > p.protectedMax() {
+			demoted, _ := p.protected.popBack()
+			p.probation.pushFront(demoted)
+		}
+	case p.protected.contains(key):
+		p.protected.pushFront(key)
+	}
+}
+
+func (p *tinyLFUPolicy) remove(key string) {
+	if !p.window.remove(key) && !p.probation.remove(key) {
+		p.protected.remove(key)
+	}
+}
+
+func (p *tinyLFUPolicy) victim(protect string) (string, bool) {
+	candidate := p.candidate
+	p.candidate = ""
+	if candidate != "" && candidate != protect && p.probation.contains(candidate) {
+		if mainvictim, ok := p.probation.back(candidate); ok && mainvictim != protect {
+			// 候选频率更高则留下, 否则淘汰候选
+			if p.sketch.estimate(candidate) > p.sketch.estimate(mainvictim) {
+				p.probation.remove(mainvictim)
+				return mainvictim, true
+			}
+			p.probation.remove(candidate)
+			return candidate, true
+		}
+	}
+	for _, l := range []*lruList{p.probation, p.protected, p.window} {
+		if key, ok := l.back(protect); ok {
+			l.remove(key)
+			return key, true
+		}
+	}
+	for _, l := range []*lruList{p.probation, p.protected, p.window} {
+		if key, ok := l.popBack(); ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// countMinSketch 4位计数器的 count-min sketch, 计数总量达到阈值后所有计数减半, 使频率随时间衰减.
+type countMinSketch struct {
+	rows    [4][]uint8
+	mask    uint64
+	seed    maphash.Seed
+	samples int
+	limit   int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := sketchMinWidth
+	for width < capacity {
+		width <<= 1
+	}
+	s := &countMinSketch{
+		mask:  uint64(width - 1),
+		seed:  maphash.MakeSeed(),
+		limit: width * 10,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) indexes(key string) [4]uint64 {
+	h := maphash.String(s.seed, key)
+	h1, h2 := h, h>>32|h<<32
+	var idx [4]uint64
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return idx
+}
+
+func (s *countMinSketch) increment(key string) {
+	for i, idx := range s.indexes(key) {
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+	s.samples++
+	if s.samples >= s.limit {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	var est uint8 = 15
+	for i, idx := range s.indexes(key) {
+		est = min(est, s.rows[i][idx])
+	}
+	return est
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.samples /= 2
+}
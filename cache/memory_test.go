@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mmtbak/microlibrary/config"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func newTestMemoryCache(t *testing.T, policy string, maxEntries int) *MemoryCache {
+	c, err := NewMemoryCacheWithParam(policy, maxEntries, 0, 1)
+	assert.Equal(t, err, nil)
+	return c
+}
+
+func TestNewMemoryCache(t *testing.T) {
+	c, err := NewCache(config.AccessPoint{Source: "memory://localhost/?policy=tinylfu&maxentries=1000&shards=8"})
+	assert.Equal(t, err, nil)
+	testMultiCache(t, c)
+
+	_, err = NewCache(config.AccessPoint{Source: "memory://localhost/?policy=unknown&maxentries=1000"})
+	assert.NotEqual(t, err, nil)
+	_, err = NewCache(config.AccessPoint{Source: "memory://localhost/?policy=lru"})
+	assert.NotEqual(t, err, nil)
+}
+
+func TestMemoryCacheInspect(t *testing.T) {
+	for _, policy := range []string{PolicyLRU, PolicyLFU, PolicyARC, PolicyTinyLFU} {
+		testInspectCache(t, newTestMemoryCache(t, policy, 100))
+	}
+}
+
+func TestMemoryCacheLRU(t *testing.T) {
+	c := newTestMemoryCache(t, PolicyLRU, 3)
+	for _, key := range []string{"a", "b", "c"} {
+		_ = c.Set([]byte(key), []byte(key), NoExpiration)
+	}
+	_, _ = c.Get([]byte("a"))
+	_ = c.Set([]byte("d"), []byte("d"), NoExpiration)
+	assert.Equal(t, c.Exists([]byte("b")), false)
+	assert.Equal(t, c.Exists([]byte("a")), true)
+	assert.Equal(t, c.Exists([]byte("d")), true)
+}
+
+func TestMemoryCacheLFU(t *testing.T) {
+	c := newTestMemoryCache(t, PolicyLFU, 3)
+	for _, key := range []string{"a", "b", "c"} {
+		_ = c.Set([]byte(key), []byte(key), NoExpiration)
+	}
+	_, _ = c.Get([]byte("a"))
+	_, _ = c.Get([]byte("a"))
+	_, _ = c.Get([]byte("b"))
+	_ = c.Set([]byte("d"), []byte("d"), NoExpiration)
+	assert.Equal(t, c.Exists([]byte("c")), false)
+	assert.Equal(t, c.Exists([]byte("a")), true)
+	assert.Equal(t, c.Exists([]byte("b")), true)
+	assert.Equal(t, c.Exists([]byte("d")), true)
+}
+
+// 频繁访问的key在一次性扫描大量新key后仍然保留
+func TestMemoryCacheScanResistance(t *testing.T) {
+	for _, policy := range []string{PolicyLFU, PolicyARC, PolicyTinyLFU} {
+		c := newTestMemoryCache(t, policy, 100)
+		for i := 0; i < 10; i++ {
+			_ = c.Set([]byte("hot"+strconv.Itoa(i)), []byte("value"), NoExpiration)
+		}
+		for round := 0; round < 5; round++ {
+			for i := 0; i < 10; i++ {
+				_, _ = c.Get([]byte("hot" + strconv.Itoa(i)))
+			}
+		}
+		for i := 0; i < 1000; i++ {
+			_ = c.Set([]byte("scan"+strconv.Itoa(i)), []byte("value"), NoExpiration)
+		}
+		hits := 0
+		for i := 0; i < 10; i++ {
+			if c.Exists([]byte("hot" + strconv.Itoa(i))) {
+				hits++
+			}
+		}
+		stats, _ := c.Stats()
+		assert.Equal(t, stats.Entries <= 100, true)
+		if hits < 8 {
+			t.Errorf("policy %s: expected hot keys retained, got %d/10", policy, hits)
+		}
+	}
+}
+
+func TestMemoryCacheMaxBytesAndEvictFunc(t *testing.T) {
+	c, err := NewMemoryCacheWithParam(PolicyLRU, 0, 100, 1)
+	assert.Equal(t, err, nil)
+	evictedKeys := []string{}
+	c.WithEvictFunc(func(key, value []byte, reason EvictReason) {
+		if reason == EvictCapacity {
+			evictedKeys = append(evictedKeys, string(key))
+		}
+	})
+	// 每个条目 1 + 39 = 40 字节
+	value := make([]byte, 39)
+	for _, key := range []string{"a", "b", "c"} {
+		_ = c.Set([]byte(key), value, NoExpiration)
+	}
+	assert.Equal(t, evictedKeys, []string{"a"})
+	stats, _ := c.Stats()
+	assert.Equal(t, stats.BytesUsed, int64(80))
+	assert.Equal(t, stats.Evictions, int64(1))
+
+	err = c.Set([]byte("large"), make([]byte, 200), NoExpiration)
+	assert.Equal(t, errors.Is(err, ErrTooLarge), true)
+}
+
+func TestMemoryCacheExpiration(t *testing.T) {
+	c := newTestMemoryCache(t, PolicyLRU, 10)
+	expired := 0
+	c.WithEvictFunc(func(key, value []byte, reason EvictReason) {
+		if reason == EvictExpired {
+			expired++
+		}
+	})
+	_ = c.Set([]byte("a"), []byte("a"), 50*time.Millisecond)
+	_ = c.Set([]byte("b"), []byte("b"), 50*time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	_, err := c.Get([]byte("a"))
+	assert.Equal(t, IsErrNotFound(err), true)
+	c.DeleteExpired()
+	assert.Equal(t, expired, 2)
+	stats, _ := c.Stats()
+	assert.Equal(t, stats.Entries, int64(0))
+	assert.Equal(t, stats.Expirations, int64(2))
+}
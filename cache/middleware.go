@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Op cache operation name.
+type Op string
+
+// cache operations.
+const (
+	OpGet    Op = "get"
+	OpSet    Op = "set"
+	OpDelete Op = "delete"
+	OpActive Op = "active"
+)
+
+// Middleware 拦截缓存操作, 调用 next 执行后续的中间件和后端.
+type Middleware func(ctx context.Context, op Op, key []byte, next func(ctx context.Context) error) error
+
+// Wrap 为任意后端添加中间件, 第一个中间件在最外层.
+func Wrap(c ContextCache, middlewares ...Middleware) ContextCache {
+	if len(middlewares) == 0 {
+		return c
+	}
+	return &middlewareCache{cache: c, middlewares: middlewares}
+}
+
+type middlewareCache struct {
+	cache       ContextCache
+	middlewares []Middleware
+}
+
+func (c *middlewareCache) invoke(ctx context.Context, op Op, key []byte, call func(ctx context.Context) error) error {
+	next := call
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		mw, inner := c.middlewares[i], next
+		next = func(ctx context.Context) error {
+			return mw(ctx, op, key, inner)
+		}
+	}
+	return next(ctx)
+}
+
+func (c *middlewareCache) Get(ctx context.Context, key []byte) (value []byte, err error) {
+	err = c.invoke(ctx, OpGet, key, func(ctx context.Context) error {
+		value, err = c.cache.Get(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+func (c *middlewareCache) Set(ctx context.Context, key, value []byte, expiration time.Duration) error {
+	return c.invoke(ctx, OpSet, key, func(ctx context.Context) error {
+		return c.cache.Set(ctx, key, value, expiration)
+	})
+}
+
+func (c *middlewareCache) Delete(ctx context.Context, key []byte) (ok bool, err error) {
+	err = c.invoke(ctx, OpDelete, key, func(ctx context.Context) error {
+		ok, err = c.cache.Delete(ctx, key)
+		return err
+	})
+	return ok, err
+}
+
+func (c *middlewareCache) Active(ctx context.Context, key []byte, expiration time.Duration) error {
+	return c.invoke(ctx, OpActive, key, func(ctx context.Context) error {
+		return c.cache.Active(ctx, key, expiration)
+	})
+}
+
+// LoggingMiddleware 记录每次操作的耗时, ErrNotFound 以外的错误使用 Warn 级别.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return func(ctx context.Context, op Op, key []byte, next func(ctx context.Context) error) error {
+		start := time.Now()
+		err := next(ctx)
+		attrs := []any{"op", op, "key", string(key), "duration", time.Since(start)}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			logger.WarnContext(ctx, "cache: operation failed", append(attrs, "error", err)...)
+			return err
+		}
+		if op == OpGet {
+			attrs = append(attrs, "hit", err == nil)
+		}
+		logger.DebugContext(ctx, "cache: operation", attrs...)
+		return err
+	}
+}
+
+// MetricsObserver 接收每次操作的耗时和结果, 用于对接 prometheus 等指标系统.
+// Get 返回 ErrNotFound 表示未命中.
+type MetricsObserver func(op Op, duration time.Duration, err error)
+
+// MetricsMiddleware 指标中间件.
+func MetricsMiddleware(observe MetricsObserver) Middleware {
+	return func(ctx context.Context, op Op, key []byte, next func(ctx context.Context) error) error {
+		start := time.Now()
+		err := next(ctx)
+		observe(op, time.Since(start), err)
+		return err
+	}
+}
+
+// StartSpanFunc 开始一个 span, 返回携带 span 的 ctx 和结束 span 的函数, 用于对接 opentelemetry 等链路系统.
+type StartSpanFunc func(ctx context.Context, name string) (context.Context, func(err error))
+
+// TracingMiddleware 链路中间件, span 名称为 cache.<op>.
+func TracingMiddleware(start StartSpanFunc) Middleware {
+	return func(ctx context.Context, op Op, key []byte, next func(ctx context.Context) error) error {
+		ctx, end := start(ctx, "cache."+string(op))
+		err := next(ctx)
+		end(err)
+		return err
+	}
+}
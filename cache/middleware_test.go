@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestMiddleware(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(ctx context.Context, op Op, key []byte, next func(ctx context.Context) error) error {
+			order = append(order, name+":"+string(op))
+			return next(ctx)
+		}
+	}
+	type observation struct {
+		op  Op
+		err error
+	}
+	var observed []observation
+	metrics := MetricsMiddleware(func(op Op, _ time.Duration, err error) {
+		observed = append(observed, observation{op, err})
+	})
+	var spans []string
+	type spanKey struct{}
+	tracing := TracingMiddleware(func(ctx context.Context, name string) (context.Context, func(error)) {
+		return context.WithValue(ctx, spanKey{}, name), func(err error) {
+			spans = append(spans, name)
+		}
+	})
+	var buf bytes.Buffer
+	logging := LoggingMiddleware(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	c := Wrap(WithContext(newTestMemoryCache(t, PolicyLRU, 100)), trace("a"), trace("b"), metrics, tracing, logging)
+	ctx := context.Background()
+	assert.Equal(t, c.Set(ctx, []byte("key"), []byte("value"), NoExpiration), nil)
+	_, err := c.Get(ctx, []byte("missing"))
+	assert.Equal(t, err, ErrNotFound)
+	ok, err := c.Delete(ctx, []byte("key"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ok, true)
+	assert.NotEqual(t, c.Active(ctx, []byte("key"), -time.Second), nil)
+
+	assert.Equal(t, order, []string{"a:set", "b:set", "a:get", "b:get", "a:delete", "b:delete", "a:active", "b:active"})
+	assert.Equal(t, observed, []observation{{OpSet, nil}, {OpGet, ErrNotFound}, {OpDelete, nil}, {OpActive, observed[3].err}})
+	assert.NotEqual(t, observed[3].err, nil)
+	assert.Equal(t, spans, []string{"cache.set", "cache.get", "cache.delete", "cache.active"})
+	logs := buf.String()
+	assert.Equal(t, strings.Count(logs, "cache: operation failed"), 1)
+	assert.Equal(t, strings.Count(logs, "hit=false"), 1)
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mmtbak/microlibrary/config"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestRedisCache(t *testing.T) {
+	server := miniredis.RunT(t)
+	conf := config.AccessPoint{
+		Source: "redis://" + server.Addr() + "/1?prefix=svc:",
+		Options: map[string]any{
+			"PoolSize":    10,
+			"DialTimeout": "1s",
+		},
+	}
+	c, err := NewCache(conf)
+	assert.Equal(t, err, nil)
+
+	key := []byte("key1")
+	value := []byte("value1")
+	err = c.Set(key, value, 2*time.Second)
+	assert.Equal(t, err, nil)
+	server.Select(1)
+	assert.Equal(t, server.Exists("svc:key1"), true)
+
+	v, err := c.Get(key)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(v), "value1")
+
+	err = c.Active(key, 5*time.Second)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, server.TTL("svc:key1"), 5*time.Second)
+
+	server.FastForward(6 * time.Second)
+	_, err = c.Get(key)
+	assert.Equal(t, err, ErrNotFound)
+	assert.Equal(t, c.Active(key, time.Second), ErrNotFound)
+
+	err = c.Set(key, value, 0)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, c.Delete(key), true)
+	assert.Equal(t, c.Delete(key), false)
+}
+
+func TestNewRedisCacheSentinelRequiresMaster(t *testing.T) {
+	_, err := NewRedisCache(config.AccessPoint{Source: "redis+sentinel://localhost:26379/0"})
+	assert.NotEqual(t, err, nil)
+}
+
+func TestRedisCacheUnavailable(t *testing.T) {
+	server := miniredis.RunT(t)
+	c, err := NewRedisCache(config.AccessPoint{Source: "redis://" + server.Addr()})
+	assert.Equal(t, err, nil)
+	server.Close()
+	_, err = c.Get([]byte("key1"))
+	assert.Equal(t, errors.Is(err, ErrUnavailable), true)
+}
+
+func TestRedisCacheRangeEscapePrefix(t *testing.T) {
+	server := miniredis.RunT(t)
+	c, err := NewRedisCache(config.AccessPoint{Source: "redis://" + server.Addr() + "/0?prefix=svc[1]*:"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, c.Set([]byte("key1"), []byte("value1"), 0), nil)
+	// 前缀中的 glob 字符按字面匹配, 不匹配其它前缀的key
+	assert.Equal(t, server.Set("svc1x:key2", "value2"), nil)
+
+	var keys []string
+	err = c.Range(func(key []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, keys, []string{"key1"})
+
+	assert.Equal(t, c.Clear(), nil)
+	assert.Equal(t, server.Exists("svc1x:key2"), true)
+}
+
+func TestEscapeGlob(t *testing.T) {
+	assert.Equal(t, escapeGlob(`a*b?c[d]e\f`), `a\*b\?c\[d\]e\\f`)
+}
@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// snapshotmagic 快照文件头.
+const snapshotmagic = "MLCACHE1"
+
+// peekCache 可以不修改命中统计和淘汰顺序读取 value 的缓存.
+type peekCache interface {
+	// peek 返回 value 和过期时间(unix nano, 0 表示不过期), key不存在或已过期返回 ErrNotFound
+	peek(key []byte) (value []byte, deadline int64, err error)
+}
+
+// snapshotChecker 可能不支持快照的缓存, 例如快照会写入解密后的明文.
+type snapshotChecker interface {
+	checkSnapshot() error
+}
+
+// WriteSnapshot 将缓存中所有未过期的key写入快照, 返回写入的条目数.
+// 每条记录为: key长度, key, value长度, value, 过期时间(unix nano, 0 表示不过期).
+// 内置后端通过 peek 读取, 不影响命中统计和淘汰顺序, 其它后端使用 TTL 和 Get.
+// EncryptCache 及包装了它的缓存返回 ErrNotSupported, 需要对其后端做快照.
+func WriteSnapshot(c InspectCache, w io.Writer) (int, error) {
+	if sc, ok := c.(snapshotChecker); ok {
+		if err := sc.checkSnapshot(); err != nil {
+			return 0, err
+		}
+	}
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(snapshotmagic); err != nil {
+		return 0, err
+	}
+	var count int
+	var werr error
+	buf := make([]byte, binary.MaxVarintLen64)
+	writeBytes := func(data []byte) {
+		n := binary.PutUvarint(buf, uint64(len(data)))
+		if _, werr = bw.Write(buf[:n]); werr == nil {
+			_, werr = bw.Write(data)
+		}
+	}
+	peek := func(key []byte) ([]byte, int64, error) {
+		ttl, err := c.TTL(key)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, err := c.Get(key)
+		if err != nil {
+			return nil, 0, err
+		}
+		var deadline int64
+		if ttl > 0 {
+			deadline = time.Now().Add(ttl).UnixNano()
+		}
+		return value, deadline, nil
+	}
+	if pc, ok := c.(peekCache); ok {
+		peek = pc.peek
+	}
+	err := c.Range(func(key []byte) bool {
+		value, deadline, err := peek(key)
+		if err != nil {
+			return true
+		}
+		if writeBytes(key); werr != nil {
+			return false
+		}
+		if writeBytes(value); werr != nil {
+			return false
+		}
+		if werr = binary.Write(bw, binary.BigEndian, deadline); werr != nil {
+			return false
+		}
+		count++
+		return true
+	})
+	if err != nil {
+		return count, err
+	}
+	if werr != nil {
+		return count, werr
+	}
+	return count, bw.Flush()
+}
+
+// ReadSnapshot 从快照恢复缓存, 按剩余时间设置过期, 已过期的条目跳过, 返回恢复的条目数.
+func ReadSnapshot(c Cache, r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotmagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return 0, err
+	}
+	if string(magic) != snapshotmagic {
+		return 0, errors.New("cache: invalid snapshot")
+	}
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, n)
+		_, err = io.ReadFull(br, data)
+		return data, err
+	}
+	var count int
+	for {
+		key, err := readBytes()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		value, err := readBytes()
+		if err != nil {
+			return count, err
+		}
+		var deadline int64
+		if err = binary.Read(br, binary.BigEndian, &deadline); err != nil {
+			return count, err
+		}
+		expiration := NoExpiration
+		if deadline != 0 {
+			if expiration = time.Until(time.Unix(0, deadline)); expiration <= 0 {
+				continue
+			}
+		}
+		if err = c.Set(key, value, expiration); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// SaveSnapshot 将缓存写入快照文件, 先写临时文件再重命名.
+func SaveSnapshot(c InspectCache, path string) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	count, err := WriteSnapshot(c, f)
+	if closeerr := f.Close(); err == nil {
+		err = closeerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return count, err
+	}
+	return count, os.Rename(tmp, path)
+}
+
+// LoadSnapshot 从快照文件恢复缓存, 文件不存在时不报错.
+func LoadSnapshot(c Cache, path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return ReadSnapshot(c, f)
+}
+
+// snapshotter 启动时从快照恢复, 后台定时保存, 关闭时保存最后一次快照.
+// 通过 dsn 参数配置: snapshot=/path/to/file&snapshotinterval=5m
+type snapshotter struct {
+	cache    InspectCache
+	path     string
+	interval time.Duration
+	done     chan struct{}
+	wg       sync.WaitGroup
+	once     sync.Once
+}
+
+// newSnapshotter 未配置 snapshot 参数时返回nil.
+func newSnapshotter(c InspectCache, params map[string]string) (*snapshotter, error) {
+	path := params["snapshot"]
+	if path == "" {
+		return nil, nil
+	}
+	s := &snapshotter{cache: c, path: path, done: make(chan struct{})}
+	if val, ok := params["snapshotinterval"]; ok {
+		var err error
+		if s.interval, err = time.ParseDuration(val); err != nil {
+			return nil, fmt.Errorf("cache: invalid snapshotinterval '%s'", val)
+		}
+	}
+	count, err := LoadSnapshot(c, path)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("cache: snapshot loaded", "path", path, "entries", count)
+	if s.interval > 0 {
+		s.wg.Add(1)
+		go s.run()
+	}
+	return s, nil
+}
+
+func (s *snapshotter) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if _, err := SaveSnapshot(s.cache, s.path); err != nil {
+				slog.Error("cache: save snapshot failed", "path", s.path, "error", err)
+			}
+		}
+	}
+}
+
+// close 停止定时保存并保存最后一次快照.
+func (s *snapshotter) close() error {
+	if s == nil {
+		return nil
+	}
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+		_, err = SaveSnapshot(s.cache, s.path)
+	})
+	return err
+}
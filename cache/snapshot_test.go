@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmtbak/microlibrary/config"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestSnapshotReadWrite(t *testing.T) {
+	src := newTestMemoryCache(t, PolicyLRU, 100)
+	_ = src.Set([]byte("forever"), []byte("v1"), NoExpiration)
+	_ = src.Set([]byte("ttl"), []byte("v2"), time.Hour)
+	_ = src.Set([]byte("short"), []byte("v3"), 50*time.Millisecond)
+
+	var buf bytes.Buffer
+	count, err := WriteSnapshot(src, &buf)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, count, 3)
+
+	time.Sleep(100 * time.Millisecond)
+	dst := newTestMemoryCache(t, PolicyLRU, 100)
+	count, err = ReadSnapshot(dst, &buf)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, count, 2)
+
+	value, err := dst.Get([]byte("forever"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, value, []byte("v1"))
+	ttl, err := dst.TTL([]byte("forever"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ttl, NoExpiration)
+
+	ttl, err = dst.TTL([]byte("ttl"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ttl > 59*time.Minute && ttl <= time.Hour, true)
+
+	_, err = dst.Get([]byte("short"))
+	assert.Equal(t, err, ErrNotFound)
+
+	_, err = ReadSnapshot(dst, bytes.NewBufferString("invalid snapshot"))
+	assert.NotEqual(t, err, nil)
+}
+
+func TestSnapshotDSN(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	for _, source := range []string{
+		"freecache://localhost/?sizekb=1024&snapshot=" + path,
+		"memory://localhost/?maxentries=100&snapshot=" + path,
+	} {
+		_ = os.Remove(path)
+		c, err := NewCache(config.AccessPoint{Source: source})
+		assert.Equal(t, err, nil)
+		_ = c.Set([]byte("key"), []byte("value"), time.Hour)
+		assert.Equal(t, c.(interface{ Close() error }).Close(), nil)
+
+		c, err = NewCache(config.AccessPoint{Source: source})
+		assert.Equal(t, err, nil)
+		value, err := c.Get([]byte("key"))
+		assert.Equal(t, err, nil)
+		assert.Equal(t, value, []byte("value"))
+	}
+}
+
+func TestSnapshotInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	c, err := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?snapshot=" + path + "&snapshotinterval=20ms"})
+	assert.Equal(t, err, nil)
+	_ = c.Set([]byte("key"), []byte("value"), NoExpiration)
+	time.Sleep(100 * time.Millisecond)
+
+	loaded := newTestMemoryCache(t, PolicyLRU, 100)
+	count, err := LoadSnapshot(loaded, path)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, count, 1)
+	assert.Equal(t, c.Close(), nil)
+	assert.Equal(t, c.Close(), nil)
+
+	_, err = NewFreecache(config.AccessPoint{Source: "freecache://localhost/?snapshot=" + path + "&snapshotinterval=abc"})
+	assert.NotEqual(t, err, nil)
+}
+
+func TestWriteSnapshotNoSideEffects(t *testing.T) {
+	fc, err := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?sizekb=1024"})
+	assert.Equal(t, err, nil)
+	for _, c := range []InspectCache{newTestMemoryCache(t, PolicyLRU, 100), fc} {
+		assert.Equal(t, c.Set([]byte("a"), []byte("1"), time.Hour), nil)
+		assert.Equal(t, c.Set([]byte("b"), []byte("2"), NoExpiration), nil)
+		before, err := c.(StatsCache).Stats()
+		assert.Equal(t, err, nil)
+
+		var buf bytes.Buffer
+		count, err := WriteSnapshot(c, &buf)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, count, 2)
+		after, err := c.(StatsCache).Stats()
+		assert.Equal(t, err, nil)
+		assert.Equal(t, after.Hits, before.Hits)
+		assert.Equal(t, after.Misses, before.Misses)
+	}
+
+	// LRU 的淘汰顺序不受快照影响
+	c := newTestMemoryCache(t, PolicyLRU, 2)
+	_ = c.Set([]byte("old"), []byte("1"), NoExpiration)
+	_ = c.Set([]byte("new"), []byte("2"), NoExpiration)
+	_, err = WriteSnapshot(c, io.Discard)
+	assert.Equal(t, err, nil)
+	_ = c.Set([]byte("third"), []byte("3"), NoExpiration)
+	assert.Equal(t, c.Exists([]byte("old")), false)
+	assert.Equal(t, c.Exists([]byte("new")), true)
+}
@@ -0,0 +1,41 @@
+package cache
+
+import "time"
+
+// Stats 缓存统计信息.
+type Stats struct {
+	Hits        int64
+	Misses      int64
+	HitRate     float64
+	Entries     int64
+	Evictions   int64 // 因空间不足被淘汰的数量
+	Expirations int64 // 过期的数量
+	BytesUsed   int64 // 数据占用的字节数
+}
+
+// StatsCache 支持统计信息的缓存.
+type StatsCache interface {
+	Cache
+	Stats() (Stats, error)
+}
+
+// InspectCache 支持查看和遍历key的缓存.
+type InspectCache interface {
+	Cache
+	// TTL 剩余过期时间, 不过期返回0, key不存在返回 ErrNotFound
+	TTL(key []byte) (time.Duration, error)
+	// Exists key是否存在
+	Exists(key []byte) bool
+	// Clear 清空缓存
+	Clear() error
+	// Range 遍历key, fn 返回false时停止遍历
+	Range(fn func(key []byte) bool) error
+}
+
+// hitRate 命中率.
+func hitRate(hits, misses int64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mmtbak/microlibrary/config"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func testInspectCache(t *testing.T, c interface {
+	StatsCache
+	InspectCache
+}) {
+	_ = c.Set([]byte("key1"), []byte("value1"), time.Minute)
+	_ = c.Set([]byte("key2"), []byte("value2"), 0)
+	_, _ = c.Get([]byte("key1"))
+	_, _ = c.Get([]byte("missing"))
+
+	stats, err := c.Stats()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, stats.Hits, int64(1))
+	assert.Equal(t, stats.Misses, int64(1))
+	assert.Equal(t, stats.HitRate, 0.5)
+	assert.Equal(t, stats.Entries, int64(2))
+
+	ttl, err := c.TTL([]byte("key1"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ttl > 58*time.Second && ttl <= time.Minute, true)
+	ttl, err = c.TTL([]byte("key2"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ttl, time.Duration(0))
+	_, err = c.TTL([]byte("missing"))
+	assert.Equal(t, IsErrNotFound(err), true)
+
+	assert.Equal(t, c.Exists([]byte("key1")), true)
+	assert.Equal(t, c.Exists([]byte("missing")), false)
+
+	keys := []string{}
+	err = c.Range(func(key []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	assert.Equal(t, err, nil)
+	sort.Strings(keys)
+	assert.Equal(t, keys, []string{"key1", "key2"})
+
+	assert.Equal(t, c.Clear(), nil)
+	assert.Equal(t, c.Exists([]byte("key1")), false)
+}
+
+func TestFreecacheInspect(t *testing.T) {
+	c, err := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?sizekb=1000"})
+	assert.Equal(t, err, nil)
+	testInspectCache(t, c)
+}
+
+func TestRedisCacheInspect(t *testing.T) {
+	server := miniredis.RunT(t)
+	// 其他前缀的key不受影响
+	_ = server.Set("other", "value")
+	c, err := NewRedisCache(config.AccessPoint{Source: "redis://" + server.Addr() + "/0?prefix=svc:"})
+	assert.Equal(t, err, nil)
+	testInspectCache(t, c)
+	assert.Equal(t, server.Exists("other"), true)
+}
+
+func TestRedisCacheClearWithoutPrefix(t *testing.T) {
+	server := miniredis.RunT(t)
+	_ = server.Set("other", "value")
+	c, err := NewRedisCache(config.AccessPoint{Source: "redis://" + server.Addr() + "/0"})
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, c.Clear(), nil)
+	assert.Equal(t, server.Exists("other"), true)
+}
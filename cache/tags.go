@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// tag/prefix 版本号的 key 前缀, 以 \x00 开头避免与业务 key 冲突.
+const (
+	tagversionprefix    = "\x00tag:"
+	prefixversionprefix = "\x00prefix:"
+)
+
+// ErrInvalidTaggedValue value 不是由 TagCache 写入的.
+var ErrInvalidTaggedValue = errors.New("cache: invalid tagged value")
+
+// TagCache 在任意 Cache 之上提供按 tag 和按前缀失效的能力.
+// 每个 tag 在后端保存一个版本号, 写入时在 value 头部记录所属 tag 的版本号,
+// 读取时版本号不一致(tag 已失效或版本号被淘汰)视为不存在. 失效只需要更新版本号, 不需要遍历 key.
+// 设置了前缀分隔符时, key 按分隔符切分出的每一级前缀都视为一个隐含的 tag, DeletePrefix 同样只更新版本号.
+type TagCache struct {
+	cache     Cache
+	delimiter []byte
+}
+
+// NewTagCache new tag cache.
+func NewTagCache(c Cache) *TagCache {
+	return &TagCache{cache: c}
+}
+
+// WithPrefixDelimiter 设置前缀分隔符, 例如 ':' 时 key "tenant:1:user" 的前缀为 "tenant:" 和 "tenant:1:".
+func (c *TagCache) WithPrefixDelimiter(delimiter string) *TagCache {
+	c.delimiter = []byte(delimiter)
+	return c
+}
+
+// Cache underlying cache.
+func (c *TagCache) Cache() Cache {
+	return c.cache
+}
+
+// Get key from cache, 所属 tag 或前缀已失效时返回 ErrNotFound.
+func (c *TagCache) Get(key []byte) ([]byte, error) {
+	data, err := c.cache.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	versionkeys, versions, value, err := decodeTagged(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(versionkeys) == 0 {
+		return value, nil
+	}
+	for idx, result := range MGet(c.cache, versionkeys) {
+		if result.Err != nil && !errors.Is(result.Err, ErrNotFound) {
+			return nil, result.Err
+		}
+		if result.Err != nil || len(result.Value) != 8 || binary.BigEndian.Uint64(result.Value) != versions[idx] {
+			c.cache.Delete(key)
+			return nil, ErrNotFound
+		}
+	}
+	return value, nil
+}
+
+// Set key to cache without tags.
+func (c *TagCache) Set(key, value []byte, expiration time.Duration) error {
+	return c.SetWithTags(key, value, expiration)
+}
+
+// SetWithTags set key to cache with tags.
+func (c *TagCache) SetWithTags(key, value []byte, expiration time.Duration, tags ...string) error {
+	versionkeys := make([][]byte, 0, len(tags))
+	for _, tag := range tags {
+		versionkeys = append(versionkeys, []byte(tagversionprefix+tag))
+	}
+	for _, prefix := range c.prefixes(key) {
+		versionkeys = append(versionkeys, []byte(prefixversionprefix+string(prefix)))
+	}
+	versions, err := c.versions(versionkeys)
+	if err != nil {
+		return err
+	}
+	return c.cache.Set(key, encodeTagged(versionkeys, versions, value), expiration)
+}
+
+// Delete key from cache.
+func (c *TagCache) Delete(key []byte) bool {
+	return c.cache.Delete(key)
+}
+
+// Active key in cache.
+func (c *TagCache) Active(key []byte, expiration time.Duration) error {
+	return c.cache.Active(key, expiration)
+}
+
+// InvalidateTag 使 tag 下的所有 key 失效.
+func (c *TagCache) InvalidateTag(tag string) error {
+	return c.bump([]byte(tagversionprefix + tag))
+}
+
+// DeletePrefix 使以 prefix 开头的所有 key 失效.
+// prefix 以分隔符结尾时只更新前缀版本号; 否则需要后端实现 InspectCache, 遍历删除匹配的 key.
+func (c *TagCache) DeletePrefix(prefix []byte) error {
+	if len(c.delimiter) > 0 && bytes.HasSuffix(prefix, c.delimiter) {
+		return c.bump([]byte(prefixversionprefix + string(prefix)))
+	}
+	inspect, ok := c.cache.(InspectCache)
+	if !ok {
+		return fmt.Errorf("cache: delete prefix '%s' requires a prefix ending with delimiter or an inspectable backend", prefix)
+	}
+	var keys [][]byte
+	err := inspect.Range(func(key []byte) bool {
+		if bytes.HasPrefix(key, prefix) {
+			keys = append(keys, bytes.Clone(key))
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	MDelete(c.cache, keys)
+	return nil
+}
+
+// prefixes key 按分隔符切分出的每一级前缀.
+func (c *TagCache) prefixes(key []byte) [][]byte {
+	if len(c.delimiter) == 0 {
+		return nil
+	}
+	var prefixes [][]byte
+	for offset := 0; ; {
+		idx := bytes.Index(key[offset:], c.delimiter)
+		if idx < 0 {
+			return prefixes
+		}
+		offset += idx + len(c.delimiter)
+		prefixes = append(prefixes, key[:offset])
+	}
+}
+
+// versions 查询版本号, 不存在时初始化.
+func (c *TagCache) versions(versionkeys [][]byte) ([]uint64, error) {
+	versions := make([]uint64, len(versionkeys))
+	for idx, result := range MGet(c.cache, versionkeys) {
+		switch {
+		case result.Err == nil && len(result.Value) == 8:
+			versions[idx] = binary.BigEndian.Uint64(result.Value)
+		case result.Err == nil || errors.Is(result.Err, ErrNotFound):
+			version, err := c.setVersion(versionkeys[idx], 0)
+			if err != nil {
+				return nil, err
+			}
+			versions[idx] = version
+		default:
+			return nil, result.Err
+		}
+	}
+	return versions, nil
+}
+
+// bump 更新版本号.
+func (c *TagCache) bump(versionkey []byte) error {
+	var current uint64
+	data, err := c.cache.Get(versionkey)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err == nil && len(data) == 8 {
+		current = binary.BigEndian.Uint64(data)
+	}
+	_, err = c.setVersion(versionkey, current)
+	return err
+}
+
+// setVersion 写入新的版本号, 取当前时间与 current+1 的较大值, 多个实例并发更新时也不会回退到旧的版本号.
+func (c *TagCache) setVersion(versionkey []byte, current uint64) (uint64, error) {
+	version := max(uint64(time.Now().UnixNano()), current+1)
+	data := binary.BigEndian.AppendUint64(nil, version)
+	return version, c.cache.Set(versionkey, data, NoExpiration)
+}
+
+// encodeTagged value 格式: tag数量, 每个tag的(版本号key长度, 版本号key, 版本号), value.
+func encodeTagged(versionkeys [][]byte, versions []uint64, value []byte) []byte {
+	data := binary.AppendUvarint(nil, uint64(len(versionkeys)))
+	for idx, versionkey := range versionkeys {
+		data = binary.AppendUvarint(data, uint64(len(versionkey)))
+		data = append(data, versionkey...)
+		data = binary.BigEndian.AppendUint64(data, versions[idx])
+	}
+	return append(data, value...)
+}
+
+func decodeTagged(data []byte) (versionkeys [][]byte, versions []uint64, value []byte, err error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > uint64(len(data)) {
+		return nil, nil, nil, ErrInvalidTaggedValue
+	}
+	data = data[n:]
+	for range count {
+		size, n := binary.Uvarint(data)
+		// 分开比较, 避免 size+8 溢出
+		if n <= 0 || size > uint64(len(data)-n) || uint64(len(data)-n)-size < 8 {
+			return nil, nil, nil, ErrInvalidTaggedValue
+		}
+		data = data[n:]
+		versionkeys = append(versionkeys, data[:size])
+		versions = append(versions, binary.BigEndian.Uint64(data[size:size+8]))
+		data = data[size+8:]
+	}
+	return versionkeys, versions, data, nil
+}
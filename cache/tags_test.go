@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mmtbak/microlibrary/config"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func testTagCache(t *testing.T, backend Cache) {
+	c := NewTagCache(backend).WithPrefixDelimiter(":")
+	assert.Equal(t, c.SetWithTags([]byte("tenant:1:user"), []byte("u1"), time.Minute, "tenant1", "users"), nil)
+	assert.Equal(t, c.SetWithTags([]byte("tenant:1:order"), []byte("o1"), time.Minute, "tenant1"), nil)
+	assert.Equal(t, c.SetWithTags([]byte("tenant:2:user"), []byte("u2"), time.Minute, "tenant2", "users"), nil)
+	assert.Equal(t, c.Set([]byte("plain"), []byte("p"), time.Minute), nil)
+
+	value, err := c.Get([]byte("tenant:1:user"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, value, []byte("u1"))
+
+	assert.Equal(t, c.InvalidateTag("tenant1"), nil)
+	_, err = c.Get([]byte("tenant:1:user"))
+	assert.Equal(t, err, ErrNotFound)
+	_, err = c.Get([]byte("tenant:1:order"))
+	assert.Equal(t, err, ErrNotFound)
+	value, err = c.Get([]byte("tenant:2:user"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, value, []byte("u2"))
+
+	// 失效后重新写入的数据使用新的版本号
+	assert.Equal(t, c.SetWithTags([]byte("tenant:1:user"), []byte("u1v2"), time.Minute, "tenant1"), nil)
+	value, err = c.Get([]byte("tenant:1:user"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, value, []byte("u1v2"))
+
+	assert.Equal(t, c.DeletePrefix([]byte("tenant:2:")), nil)
+	_, err = c.Get([]byte("tenant:2:user"))
+	assert.Equal(t, err, ErrNotFound)
+	value, err = c.Get([]byte("tenant:1:user"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, value, []byte("u1v2"))
+
+	assert.Equal(t, c.DeletePrefix([]byte("tenant:")), nil)
+	_, err = c.Get([]byte("tenant:1:user"))
+	assert.Equal(t, err, ErrNotFound)
+
+	// 前缀不以分隔符结尾时遍历删除
+	assert.Equal(t, c.Set([]byte("plain2"), []byte("p2"), time.Minute), nil)
+	assert.Equal(t, c.DeletePrefix([]byte("pla")), nil)
+	_, err = c.Get([]byte("plain"))
+	assert.Equal(t, err, ErrNotFound)
+	_, err = c.Get([]byte("plain2"))
+	assert.Equal(t, err, ErrNotFound)
+}
+
+func TestTagCache(t *testing.T) {
+	fc, err := NewFreecache(config.AccessPoint{Source: "freecache://localhost/"})
+	assert.Equal(t, err, nil)
+	testTagCache(t, fc)
+
+	testTagCache(t, newTestMemoryCache(t, PolicyLRU, 100))
+
+	server := miniredis.RunT(t)
+	rc, err := NewRedisCache(config.AccessPoint{Source: "redis://" + server.Addr() + "/0?prefix=svc:"})
+	assert.Equal(t, err, nil)
+	testTagCache(t, rc)
+}
+
+func TestTagCacheVersionEvicted(t *testing.T) {
+	backend := newTestMemoryCache(t, PolicyLRU, 100)
+	c := NewTagCache(backend)
+	assert.Equal(t, c.SetWithTags([]byte("key"), []byte("value"), NoExpiration, "tag"), nil)
+	backend.Delete([]byte(tagversionprefix + "tag"))
+	_, err := c.Get([]byte("key"))
+	assert.Equal(t, err, ErrNotFound)
+
+	assert.Equal(t, backend.Set([]byte("raw"), []byte{0xff}, NoExpiration), nil)
+	_, err = c.Get([]byte("raw"))
+	assert.Equal(t, err, ErrInvalidTaggedValue)
+
+	assert.NotEqual(t, NewTagCache(struct{ Cache }{backend}).DeletePrefix([]byte("k")), nil)
+}
+
+func TestDecodeTaggedOverflow(t *testing.T) {
+	// 版本key长度为 math.MaxUint64, size+8 溢出
+	data := append([]byte{0x01}, bytes.Repeat([]byte{0xff}, 9)...)
+	data = append(data, 0x01)
+	data = append(data, make([]byte, 18-len(data))...)
+	assert.Equal(t, len(data), 18)
+	_, _, _, err := decodeTagged(data)
+	assert.Equal(t, err, ErrInvalidTaggedValue)
+}
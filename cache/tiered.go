@@ -0,0 +1,331 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmtbak/microlibrary/config"
+	"github.com/mmtbak/microlibrary/mq"
+)
+
+// default l1 ttl 1 minute.
+const defaultl1ttl = time.Minute
+
+// TieredCache 两级缓存, L1 为进程内缓存, L2 为远程缓存.
+// 读取时 L1 -> L2, L2 命中后以 l1ttl 和 L2 剩余过期时间中较短的一个回填 L1;
+// 写入和删除同时作用于两级缓存, 并通过消息队列广播给其他实例, 其他实例删除自身的 L1.
+type TieredCache struct {
+	l1     Cache
+	l2     Cache
+	l1ttl  time.Duration
+	id     string // 实例ID, 忽略自身发出的失效消息
+	queue  mq.MessageQueue
+	done   chan struct{}
+	closed sync.Once
+	logger *slog.Logger
+}
+
+// TieredOptions tiered cache 配置, 从 config.AccessPoint.Options 解析.
+type TieredOptions struct {
+	L1 config.AccessPoint
+	L2 config.AccessPoint
+	// Invalidation 失效消息队列, 为空时不广播.
+	// 每个实例需要独立的消费者组才能收到全部失效消息, 消费者组会被替换为 consumergroup 参数(默认 tiered-cache)加实例ID
+	Invalidation string
+}
+
+// invalidation 失效消息
+type invalidation struct {
+	Instance string `json:"instance"`
+	Key      []byte `json:"key"`
+}
+
+// NewTieredCache new tiered cache.
+// tiered://localhost/?l1ttl=30s
+// Options: {"L1": {"Source": "freecache://..."}, "L2": {"Source": "redis://..."}, "Invalidation": "kafka://..."}
+func NewTieredCache(conf config.AccessPoint) (*TieredCache, error) {
+	var err error
+	var option TieredOptions
+	if err = conf.DecodeOption(&option); err != nil {
+		return nil, err
+	}
+	l1ttl := defaultl1ttl
+	if val, ok := conf.Decode().Params["l1ttl"]; ok {
+		if l1ttl, err = time.ParseDuration(val); err != nil {
+			return nil, err
+		}
+	}
+	l1, err := NewCache(option.L1)
+	if err != nil {
+		return nil, err
+	}
+	l2, err := NewCache(option.L2)
+	if err != nil {
+		return nil, err
+	}
+	c := NewTieredCacheWithBackend(l1, l2, l1ttl)
+	if option.Invalidation != "" {
+		queue, err := mq.NewMessageQueue(instanceGroupSource(option.Invalidation, c.id))
+		if err != nil {
+			return nil, err
+		}
+		if err = c.WithInvalidation(queue); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// defaultinvalidationgroup 失效消息消费者组的默认前缀.
+const defaultinvalidationgroup = "tiered-cache"
+
+// instanceGroupSource 将失效消息队列的消费者组替换为实例独立的消费者组, 保证每个实例都能收到广播.
+// 只修改 consumergroup 参数, 其它部分保持原样.
+func instanceGroupSource(source, id string) string {
+	base, query, _ := strings.Cut(source, "?")
+	group := defaultinvalidationgroup
+	params := make([]string, 0, 4)
+	for _, param := range strings.Split(query, "&") {
+		if name, value, _ := strings.Cut(param, "="); name == "consumergroup" {
+			if value != "" {
+				group = value
+			}
+		} else if param != "" {
+			params = append(params, param)
+		}
+	}
+	params = append(params, "consumergroup="+group+"-"+id)
+	return base + "?" + strings.Join(params, "&")
+}
+
+// NewTieredCacheWithBackend new tiered cache with l1 and l2 backend.
+func NewTieredCacheWithBackend(l1, l2 Cache, l1ttl time.Duration) *TieredCache {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return &TieredCache{
+		l1:     l1,
+		l2:     l2,
+		l1ttl:  l1ttl,
+		id:     hex.EncodeToString(buf),
+		logger: slog.Default(),
+	}
+}
+
+// SetLogger set logger.
+func (c *TieredCache) SetLogger(l *slog.Logger) {
+	c.logger = l
+}
+
+// WithInvalidation 使用消息队列广播失效消息, 并开始接收其他实例的失效消息.
+// queue 必须使用本实例独立的消费者组, 多个实例共享消费者组时每条失效消息只有一个实例收到.
+func (c *TieredCache) WithInvalidation(queue mq.MessageQueue) error {
+	msgs, err := queue.ReceiveMessage()
+	if err != nil {
+		return err
+	}
+	c.queue = queue
+	c.done = make(chan struct{})
+	go c.receive(msgs)
+	return nil
+}
+
+// Close stop receiving invalidation message, 并关闭 l1 和 l2, 例如 memory/freecache 在关闭时保存快照.
+// 重复调用只关闭一次.
+func (c *TieredCache) Close() error {
+	var err error
+	c.closed.Do(func() {
+		var errs []error
+		if c.queue != nil {
+			close(c.done)
+			errs = append(errs, c.queue.Close())
+		}
+		for _, backend := range []Cache{c.l1, c.l2} {
+			if closer, ok := backend.(interface{ Close() error }); ok {
+				errs = append(errs, closer.Close())
+			}
+		}
+		err = errors.Join(errs...)
+	})
+	return err
+}
+
+// Get key from l1, fall through to l2 and backfill l1.
+func (c *TieredCache) Get(key []byte) (value []byte, err error) {
+	value, err = c.l1.Get(key)
+	if err == nil {
+		return value, nil
+	}
+	value, err = c.l2.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	expiration, ok := c.backfillExpiration(key)
+	if !ok {
+		return value, nil
+	}
+	if err = c.l1.Set(key, value, expiration); err != nil {
+		c.logger.Warn("cache: backfill l1 failed", "error", err)
+	}
+	return value, nil
+}
+
+// Set key to l2 and l1, then broadcast invalidation.
+func (c *TieredCache) Set(key, value []byte, expiration time.Duration) error {
+	if err := c.l2.Set(key, value, expiration); err != nil {
+		return err
+	}
+	if err := c.l1.Set(key, value, c.l1expiration(expiration)); err != nil {
+		// 避免 l1 保留旧值
+		c.l1.Delete(key)
+	}
+	c.publish(key)
+	return nil
+}
+
+// Delete key from l2 and l1, then broadcast invalidation.
+func (c *TieredCache) Delete(key []byte) bool {
+	deleted := c.l2.Delete(key)
+	if c.l1.Delete(key) {
+		deleted = true
+	}
+	c.publish(key)
+	return deleted
+}
+
+// Active key in l2 and l1.
+func (c *TieredCache) Active(key []byte, expiration time.Duration) error {
+	if err := c.l2.Active(key, expiration); err != nil {
+		c.l1.Delete(key)
+		return err
+	}
+	if err := c.l1.Active(key, c.l1expiration(expiration)); err != nil && !IsErrNotFound(err) {
+		c.l1.Delete(key)
+	}
+	return nil
+}
+
+// MGet keys from l1, fall through to l2 for missing keys and backfill l1.
+func (c *TieredCache) MGet(keys [][]byte) []Result {
+	results := MGet(c.l1, keys)
+	missidx := make([]int, 0, len(keys))
+	misskeys := make([][]byte, 0, len(keys))
+	for idx, result := range results {
+		if result.Err != nil {
+			missidx = append(missidx, idx)
+			misskeys = append(misskeys, keys[idx])
+		}
+	}
+	if len(misskeys) == 0 {
+		return results
+	}
+	backfill := make([]Item, 0, len(misskeys))
+	for i, result := range MGet(c.l2, misskeys) {
+		results[missidx[i]] = result
+		if result.Err != nil {
+			continue
+		}
+		if expiration, ok := c.backfillExpiration(result.Key); ok {
+			backfill = append(backfill, Item{Key: result.Key, Value: result.Value, Expiration: expiration})
+		}
+	}
+	MSet(c.l1, backfill)
+	return results
+}
+
+// MSet keys to l2 and l1, then broadcast invalidation.
+func (c *TieredCache) MSet(items []Item) []error {
+	errs := MSet(c.l2, items)
+	l1items := make([]Item, 0, len(items))
+	for idx, item := range items {
+		if errs[idx] == nil {
+			l1items = append(l1items, Item{Key: item.Key, Value: item.Value, Expiration: c.l1expiration(item.Expiration)})
+		}
+	}
+	for idx, err := range MSet(c.l1, l1items) {
+		if err != nil {
+			c.l1.Delete(l1items[idx].Key)
+		}
+	}
+	for _, item := range l1items {
+		c.publish(item.Key)
+	}
+	return errs
+}
+
+// MDelete keys from l2 and l1, then broadcast invalidation.
+func (c *TieredCache) MDelete(keys [][]byte) []bool {
+	deleted := MDelete(c.l2, keys)
+	for idx, ok := range MDelete(c.l1, keys) {
+		deleted[idx] = deleted[idx] || ok
+	}
+	for _, key := range keys {
+		c.publish(key)
+	}
+	return deleted
+}
+
+// l1expiration l1 过期时间不超过 l1ttl.
+func (c *TieredCache) l1expiration(expiration time.Duration) time.Duration {
+	if c.l1ttl > 0 && (expiration <= 0 || expiration > c.l1ttl) {
+		return c.l1ttl
+	}
+	return expiration
+}
+
+// backfillExpiration 回填 l1 的过期时间, 不超过 l2 的剩余过期时间.
+// l2 不支持 TTL 时使用 l1ttl, l1ttl 为 0 时使用 defaultl1ttl, 避免回填的数据永不过期.
+// key 在 l2 中已过期时返回 false, 不回填.
+func (c *TieredCache) backfillExpiration(key []byte) (time.Duration, bool) {
+	if ic, ok := c.l2.(InspectCache); ok {
+		remaining, err := ic.TTL(key)
+		if err == nil {
+			return c.l1expiration(remaining), true
+		}
+		if IsErrNotFound(err) {
+			return 0, false
+		}
+	}
+	if c.l1ttl > 0 {
+		return c.l1ttl, true
+	}
+	return defaultl1ttl, true
+}
+
+func (c *TieredCache) publish(key []byte) {
+	if c.queue == nil {
+		return
+	}
+	data, err := json.Marshal(invalidation{Instance: c.id, Key: key})
+	if err == nil {
+		err = c.queue.SendMessage(data)
+	}
+	if err != nil {
+		c.logger.Error("cache: publish invalidation failed", "key", string(key), "error", err)
+	}
+}
+
+func (c *TieredCache) receive(msgs <-chan mq.Message) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			var inv invalidation
+			if err := json.Unmarshal(msg.Body(), &inv); err != nil {
+				c.logger.Error("cache: invalid invalidation message", "id", msg.ID(), "error", err)
+			} else if inv.Instance != c.id {
+				c.l1.Delete(inv.Key)
+			}
+			_ = msg.Ack()
+		}
+	}
+}
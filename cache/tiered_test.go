@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mmtbak/microlibrary/config"
+	"github.com/mmtbak/microlibrary/mq"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// memoryBus 进程内广播, 模拟每个实例独立消费者组的消息队列
+type memoryBus struct {
+	mutex  sync.Mutex
+	queues []*memoryQueue
+}
+
+type memoryQueue struct {
+	bus *memoryBus
+	ch  chan mq.Message
+}
+
+type memoryMessage struct {
+	id   string
+	body []byte
+}
+
+func (m *memoryMessage) ID() string   { return m.id }
+func (m *memoryMessage) Body() []byte { return m.body }
+func (m *memoryMessage) Ack() error   { return nil }
+func (m *memoryMessage) Nack() error  { return nil }
+
+func (b *memoryBus) NewQueue() *memoryQueue {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	q := &memoryQueue{bus: b, ch: make(chan mq.Message, 100)}
+	b.queues = append(b.queues, q)
+	return q
+}
+
+func (q *memoryQueue) SyncSchema() error { return nil }
+
+func (q *memoryQueue) SendMessage(b []byte, opts ...*mq.SendMsgOption) error {
+	q.bus.mutex.Lock()
+	defer q.bus.mutex.Unlock()
+	for idx, queue := range q.bus.queues {
+		queue.ch <- &memoryMessage{id: strconv.Itoa(idx), body: b}
+	}
+	return nil
+}
+
+func (q *memoryQueue) ReceiveMessage() (<-chan mq.Message, error) { return q.ch, nil }
+
+func (q *memoryQueue) Close() error { return nil }
+
+func TestNewTieredCache(t *testing.T) {
+	server := miniredis.RunT(t)
+	conf := config.AccessPoint{
+		Source: "tiered://localhost/?l1ttl=1s",
+		Options: map[string]any{
+			"L1": map[string]any{"Source": "freecache://localhost/?sizekb=1000"},
+			"L2": map[string]any{"Source": "redis://" + server.Addr()},
+		},
+	}
+	c, err := NewCache(conf)
+	assert.Equal(t, err, nil)
+
+	err = c.Set([]byte("key1"), []byte("value1"), time.Minute)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, server.TTL("key1"), time.Minute)
+
+	// l1 过期后从 l2 读取
+	time.Sleep(1100 * time.Millisecond)
+	v, err := c.Get([]byte("key1"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(v), "value1")
+
+	assert.Equal(t, c.Delete([]byte("key1")), true)
+	_, err = c.Get([]byte("key1"))
+	assert.Equal(t, IsErrNotFound(err), true)
+}
+
+func TestTieredCacheInvalidation(t *testing.T) {
+	newfreecache := func() Cache {
+		c, _ := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?sizekb=1000"})
+		return c
+	}
+	bus := &memoryBus{}
+	l2 := newfreecache()
+	a := NewTieredCacheWithBackend(newfreecache(), l2, time.Minute)
+	b := NewTieredCacheWithBackend(newfreecache(), l2, time.Minute)
+	assert.Equal(t, a.WithInvalidation(bus.NewQueue()), nil)
+	assert.Equal(t, b.WithInvalidation(bus.NewQueue()), nil)
+	defer a.Close()
+	defer b.Close()
+
+	key := []byte("key1")
+	err := a.Set(key, []byte("value1"), 0)
+	assert.Equal(t, err, nil)
+	v, err := b.Get(key)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(v), "value1")
+
+	// a 更新后 b 的 l1 被删除, 读到新值
+	err = a.Set(key, []byte("value2"), 0)
+	assert.Equal(t, err, nil)
+	time.Sleep(50 * time.Millisecond)
+	v, err = b.Get(key)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(v), "value2")
+	v, err = a.Get(key)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(v), "value2")
+}
+
+func TestTieredCacheBackfillExpiration(t *testing.T) {
+	l1 := newTestMemoryCache(t, PolicyLRU, 100)
+	l2 := newTestMemoryCache(t, PolicyLRU, 100)
+	c := NewTieredCacheWithBackend(l1, l2, time.Minute)
+
+	// l1 不超过 l2 的剩余过期时间
+	assert.Equal(t, l2.Set([]byte("short"), []byte("value"), time.Second), nil)
+	_, err := c.Get([]byte("short"))
+	assert.Equal(t, err, nil)
+	ttl, err := l1.TTL([]byte("short"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ttl > 0 && ttl <= time.Second, true)
+
+	assert.Equal(t, l2.Set([]byte("multi"), []byte("value"), time.Second), nil)
+	c.MGet([][]byte{[]byte("multi")})
+	ttl, err = l1.TTL([]byte("multi"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ttl > 0 && ttl <= time.Second, true)
+
+	// l1ttl 为 0 且 l2 不支持 TTL 时, 回填的数据仍然会过期
+	c = NewTieredCacheWithBackend(l1, struct{ Cache }{l2}, 0)
+	assert.Equal(t, l2.Set([]byte("forever"), []byte("value"), NoExpiration), nil)
+	_, err = c.Get([]byte("forever"))
+	assert.Equal(t, err, nil)
+	ttl, err = l1.TTL([]byte("forever"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ttl > 0 && ttl <= defaultl1ttl, true)
+}
+
+func TestInstanceGroupSource(t *testing.T) {
+	a := instanceGroupSource("kafka://localhost:9092/?topics=a,b&consumergroup=svc", "a")
+	b := instanceGroupSource("kafka://localhost:9092/?topics=a,b&consumergroup=svc", "b")
+	assert.Equal(t, a, "kafka://localhost:9092/?topics=a,b&consumergroup=svc-a")
+	assert.NotEqual(t, a, b)
+
+	source := instanceGroupSource("kafka://host1:9092,host2:9092/?topics=invalidation", "a")
+	assert.Equal(t, source, "kafka://host1:9092,host2:9092/?topics=invalidation&consumergroup=tiered-cache-a")
+	source = instanceGroupSource("kafka://localhost:9092", "a")
+	assert.Equal(t, source, "kafka://localhost:9092?consumergroup=tiered-cache-a")
+}
+
+func TestTieredCacheClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "l1.snapshot")
+	l1, err := NewMemoryCache(config.AccessPoint{Source: "memory://localhost/?maxentries=100&snapshot=" + path})
+	assert.Equal(t, err, nil)
+	l2, err := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?sizekb=1000"})
+	assert.Equal(t, err, nil)
+	c := NewTieredCacheWithBackend(l1, l2, time.Minute)
+	assert.Equal(t, c.WithInvalidation((&memoryBus{}).NewQueue()), nil)
+	assert.Equal(t, c.Set([]byte("key1"), []byte("value1"), 0), nil)
+
+	// 重复关闭不会 panic, l1 关闭时保存快照
+	assert.Equal(t, c.Close(), nil)
+	assert.Equal(t, c.Close(), nil)
+	restored, err := NewMemoryCache(config.AccessPoint{Source: "memory://localhost/?maxentries=100&snapshot=" + path})
+	assert.Equal(t, err, nil)
+	v, err := restored.Get([]byte("key1"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(v), "value1")
+}
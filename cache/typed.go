@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultLoadTimeout loader 的默认超时时间.
+const defaultLoadTimeout = 30 * time.Second
+
+// staleheadersize stale 模式下 value 头部保存新鲜截止时间(unix nano)的长度.
+const staleheadersize = 8
+
+// LoadFunc 缓存未命中时加载数据.
+type LoadFunc[V any] func(ctx context.Context) (V, error)
+
+// TypedCache 在 Cache 之上提供类型化的 key/value, key 通过 keyEncoder 编码, value 通过 codec 编解码.
+// GetOrLoad 对同一个 key 的并发未命中只会调用一次 loader.
+type TypedCache[K any, V any] struct {
+	cache      Cache
+	keyEncoder func(K) []byte
+	codec      Codec
+	group      singleflight.Group
+	// staleTTL 过期后仍可返回旧值的时长, 期间由后台刷新, 0 表示不开启
+	staleTTL time.Duration
+	// jitter 过期时间随机增加的比例, 避免大量key同时过期
+	jitter float64
+	// loadTimeout loader 的超时时间, loader 不受单个调用方 ctx 取消的影响
+	loadTimeout time.Duration
+	logger      *slog.Logger
+}
+
+// NewTypedCache new typed cache, 默认使用 FmtKey 编码 key, JSONCodec 编解码 value.
+func NewTypedCache[K any, V any](c Cache) *TypedCache[K, V] {
+	return &TypedCache[K, V]{
+		cache:       c,
+		keyEncoder:  FmtKey[K],
+		codec:       JSONCodec{},
+		loadTimeout: defaultLoadTimeout,
+		logger:      slog.Default(),
+	}
+}
+
+// SetLogger set logger.
+func (c *TypedCache[K, V]) SetLogger(l *slog.Logger) {
+	c.logger = l
+}
+
+// WithLoadTimeout set loader timeout, 不大于0时不设置超时.
+func (c *TypedCache[K, V]) WithLoadTimeout(timeout time.Duration) *TypedCache[K, V] {
+	c.loadTimeout = timeout
+	return c
+}
+
+// WithKeyEncoder set key encoder.
+func (c *TypedCache[K, V]) WithKeyEncoder(encoder func(K) []byte) *TypedCache[K, V] {
+	c.keyEncoder = encoder
+	return c
+}
+
+// WithCodec set value codec.
+func (c *TypedCache[K, V]) WithCodec(codec Codec) *TypedCache[K, V] {
+	c.codec = codec
+	return c
+}
+
+// WithStaleWhileRevalidate 开启 stale-while-revalidate, 过期后 staleTTL 内 GetOrLoad 返回旧值并在后台刷新.
+// 开启后 value 头部会保存新鲜截止时间, 与未开启时写入的数据不兼容.
+func (c *TypedCache[K, V]) WithStaleWhileRevalidate(staleTTL time.Duration) *TypedCache[K, V] {
+	c.staleTTL = staleTTL
+	return c
+}
+
+// WithJitter 过期时间随机增加 [0, ttl*fraction) 的时长.
+func (c *TypedCache[K, V]) WithJitter(fraction float64) *TypedCache[K, V] {
+	c.jitter = fraction
+	return c
+}
+
+// Cache underlying cache.
+func (c *TypedCache[K, V]) Cache() Cache {
+	return c.cache
+}
+
+// Get key from cache, stale 的数据视为不存在.
+func (c *TypedCache[K, V]) Get(key K) (value V, err error) {
+	value, fresh, err := c.get(c.keyEncoder(key))
+	if err == nil && !fresh {
+		var zero V
+		return zero, ErrNotFound
+	}
+	return value, err
+}
+
+// Set key to cache.
+func (c *TypedCache[K, V]) Set(key K, value V, expiration time.Duration) error {
+	return c.set(c.keyEncoder(key), value, expiration)
+}
+
+// Delete key from cache.
+func (c *TypedCache[K, V]) Delete(key K) bool {
+	return c.cache.Delete(c.keyEncoder(key))
+}
+
+// Active key in cache.
+func (c *TypedCache[K, V]) Active(key K, expiration time.Duration) error {
+	if c.staleTTL <= 0 {
+		return c.cache.Active(c.keyEncoder(key), expiration)
+	}
+	// stale 模式下需要同时刷新头部的新鲜截止时间
+	rawkey := c.keyEncoder(key)
+	data, err := c.cache.Get(rawkey)
+	if err != nil {
+		return err
+	}
+	if len(data) < staleheadersize {
+		return errors.New("cache: invalid stale entry")
+	}
+	return c.setRaw(rawkey, data[staleheadersize:], expiration)
+}
+
+// GetOrLoad 读穿缓存: 命中时直接返回, 否则调用 loader 加载并写入缓存.
+// 同一个 key 的并发未命中只调用一次 loader; 开启 stale-while-revalidate 时, 过期的数据直接返回并在后台刷新.
+// 缓存不可用或数据无法解码时同样调用 loader, 写入缓存失败不影响返回值.
+// loader 使用去掉取消的 ctx 并设置 loadTimeout, 某个调用方取消时只有它自己返回 ctx 的错误.
+func (c *TypedCache[K, V]) GetOrLoad(ctx context.Context, key K, loader LoadFunc[V],
+	ttl time.Duration) (V, error) {
+	rawkey := c.keyEncoder(key)
+	value, fresh, err := c.get(rawkey)
+	if err == nil {
+		if !fresh {
+			go func() {
+				if _, err := c.load(context.WithoutCancel(ctx), rawkey, loader, ttl); err != nil {
+					c.logger.Warn("cache: revalidate stale entry failed", "key", string(rawkey), "error", err)
+				}
+			}()
+		}
+		return value, nil
+	}
+	return c.load(ctx, rawkey, loader, ttl)
+}
+
+// load 合并同一个 key 的并发加载.
+func (c *TypedCache[K, V]) load(ctx context.Context, rawkey []byte, loader LoadFunc[V],
+	ttl time.Duration) (V, error) {
+	resultChan := c.group.DoChan(string(rawkey), func() (any, error) {
+		// 等待期间可能已被其他调用加载
+		if value, fresh, err := c.get(rawkey); err == nil && fresh {
+			return value, nil
+		}
+		loadctx := context.WithoutCancel(ctx)
+		if c.loadTimeout > 0 {
+			var cancel context.CancelFunc
+			loadctx, cancel = context.WithTimeout(loadctx, c.loadTimeout)
+			defer cancel()
+		}
+		value, err := loader(loadctx)
+		if err != nil {
+			return value, err
+		}
+		_ = c.set(rawkey, value, ttl)
+		return value, nil
+	})
+	select {
+	case result := <-resultChan:
+		value, _ := result.Val.(V)
+		return value, result.Err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// get 返回值以及是否新鲜.
+func (c *TypedCache[K, V]) get(rawkey []byte) (value V, fresh bool, err error) {
+	data, err := c.cache.Get(rawkey)
+	if err != nil {
+		return value, false, err
+	}
+	fresh = true
+	if c.staleTTL > 0 {
+		if len(data) < staleheadersize {
+			return value, false, errors.New("cache: invalid stale entry")
+		}
+		freshuntil := int64(binary.BigEndian.Uint64(data[:staleheadersize]))
+		fresh = freshuntil == 0 || time.Now().UnixNano() < freshuntil
+		data = data[staleheadersize:]
+	}
+	err = c.codec.Unmarshal(data, &value)
+	return value, fresh, err
+}
+
+func (c *TypedCache[K, V]) set(rawkey []byte, value V, expiration time.Duration) error {
+	data, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.setRaw(rawkey, data, expiration)
+}
+
+// setRaw 写入编码后的数据, 增加随机过期时间, stale 模式下增加头部.
+func (c *TypedCache[K, V]) setRaw(rawkey []byte, data []byte, expiration time.Duration) error {
+	if expiration > 0 && c.jitter > 0 {
+		if n := int64(float64(expiration) * c.jitter); n > 0 {
+			expiration += time.Duration(rand.Int64N(n))
+		}
+	}
+	if c.staleTTL <= 0 {
+		return c.cache.Set(rawkey, data, expiration)
+	}
+
+	var freshuntil int64
+	if expiration > 0 {
+		freshuntil = time.Now().Add(expiration).UnixNano()
+		expiration += c.staleTTL
+	}
+	entry := make([]byte, staleheadersize, staleheadersize+len(data))
+	binary.BigEndian.PutUint64(entry, uint64(freshuntil))
+	return c.cache.Set(rawkey, append(entry, data...), expiration)
+}
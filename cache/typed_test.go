@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mmtbak/microlibrary/config"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+type typedUser struct {
+	ID   int
+	Name string
+}
+
+func TestTypedCache(t *testing.T) {
+	c, err := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?sizekb=1000"})
+	assert.Equal(t, err, nil)
+
+	codecs := []Codec{JSONCodec{}, GobCodec{}, MsgpackCodec{}}
+	for _, codec := range codecs {
+		users := NewTypedCache[int, typedUser](c).
+			WithKeyEncoder(PrefixKey("user:", FmtKey[int])).
+			WithCodec(codec)
+		err = users.Set(1, typedUser{ID: 1, Name: "alice"}, time.Minute)
+		assert.Equal(t, err, nil)
+		user, err := users.Get(1)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, user, typedUser{ID: 1, Name: "alice"})
+		_, err = c.Get([]byte("user:1"))
+		assert.Equal(t, err, nil)
+		assert.Equal(t, users.Delete(1), true)
+	}
+}
+
+func TestTypedCacheGetOrLoad(t *testing.T) {
+	c, err := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?sizekb=1000"})
+	assert.Equal(t, err, nil)
+	users := NewTypedCache[string, typedUser](c).WithKeyEncoder(StringKey[string])
+
+	loads := 0
+	loader := func(ctx context.Context) (typedUser, error) {
+		loads++
+		return typedUser{ID: 2, Name: "bob"}, nil
+	}
+	for i := 0; i < 3; i++ {
+		user, err := users.GetOrLoad(context.Background(), "bob", loader, time.Minute)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, user.Name, "bob")
+	}
+	assert.Equal(t, loads, 1)
+
+	loaderr := errors.New("load failed")
+	_, err = users.GetOrLoad(context.Background(), "carol", func(ctx context.Context) (typedUser, error) {
+		return typedUser{}, loaderr
+	}, time.Minute)
+	assert.Equal(t, err, loaderr)
+	_, err = users.Get("carol")
+	assert.Equal(t, IsErrNotFound(err), true)
+}
+
+func TestTypedCacheSingleflight(t *testing.T) {
+	c, err := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?sizekb=1000"})
+	assert.Equal(t, err, nil)
+	users := NewTypedCache[int, typedUser](c).WithJitter(0.1)
+
+	var loads atomic.Int32
+	loader := func(ctx context.Context) (typedUser, error) {
+		loads.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return typedUser{ID: 1, Name: "alice"}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := users.GetOrLoad(context.Background(), 1, loader, time.Minute)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, user.Name, "alice")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, loads.Load(), int32(1))
+}
+
+func TestTypedCacheLoaderCallerCanceled(t *testing.T) {
+	users := NewTypedCache[int, typedUser](newTestMemoryCache(t, PolicyLRU, 100))
+	started := make(chan struct{})
+	loader := func(ctx context.Context) (typedUser, error) {
+		close(started)
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return typedUser{ID: 1, Name: "alice"}, nil
+		case <-ctx.Done():
+			return typedUser{}, ctx.Err()
+		}
+	}
+	// 第一个调用方取消后, 合并等待的调用方仍然得到加载结果
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := users.GetOrLoad(ctx, 1, loader, time.Minute)
+		errs <- err
+	}()
+	<-started
+	waiter := make(chan typedUser, 1)
+	go func() {
+		user, err := users.GetOrLoad(context.Background(), 1, loader, time.Minute)
+		assert.Equal(t, err, nil)
+		waiter <- user
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	assert.Equal(t, <-errs, context.Canceled)
+	assert.Equal(t, (<-waiter).Name, "alice")
+}
+
+func TestTypedCacheStaleWhileRevalidate(t *testing.T) {
+	c, err := NewFreecache(config.AccessPoint{Source: "freecache://localhost/?sizekb=1000"})
+	assert.Equal(t, err, nil)
+	users := NewTypedCache[int, typedUser](c).WithStaleWhileRevalidate(5 * time.Second)
+
+	var loads atomic.Int32
+	loader := func(ctx context.Context) (typedUser, error) {
+		n := loads.Add(1)
+		return typedUser{ID: 1, Name: "version" + strconv.Itoa(int(n))}, nil
+	}
+	user, err := users.GetOrLoad(context.Background(), 1, loader, time.Second)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Name, "version1")
+
+	// 过期后返回旧值, 后台刷新
+	time.Sleep(1100 * time.Millisecond)
+	_, err = users.Get(1)
+	assert.Equal(t, IsErrNotFound(err), true)
+	user, err = users.GetOrLoad(context.Background(), 1, loader, time.Second)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Name, "version1")
+	time.Sleep(50 * time.Millisecond)
+	user, err = users.Get(1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Name, "version2")
+}
@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// valueCodec 在写入后端前转换 value, 读取时还原.
+type valueCodec interface {
+	encodeValue(key, value []byte) ([]byte, error)
+	decodeValue(key, data []byte) ([]byte, error)
+}
+
+// valueCache CompressCache 和 EncryptCache 的公共部分, 转换 value 并透传后端的可选能力,
+// 包括批量操作, 统计, 遍历, context 和 Close, 后端不支持的能力返回 ErrNotSupported.
+type valueCache struct {
+	cache Cache
+	codec valueCodec
+}
+
+// Cache underlying cache.
+func (c *valueCache) Cache() Cache {
+	return c.cache
+}
+
+// Get key from cache.
+func (c *valueCache) Get(key []byte) ([]byte, error) {
+	data, err := c.cache.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.codec.decodeValue(key, data)
+}
+
+// Set key to cache.
+func (c *valueCache) Set(key, value []byte, expiration time.Duration) error {
+	data, err := c.codec.encodeValue(key, value)
+	if err != nil {
+		return err
+	}
+	return c.cache.Set(key, data, expiration)
+}
+
+// Delete key from cache.
+func (c *valueCache) Delete(key []byte) bool {
+	return c.cache.Delete(key)
+}
+
+// Active key in cache.
+func (c *valueCache) Active(key []byte, expiration time.Duration) error {
+	return c.cache.Active(key, expiration)
+}
+
+// GetContext get key with context.
+func (c *valueCache) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	data, err := WithContext(c.cache).Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.codec.decodeValue(key, data)
+}
+
+// SetContext set key with context.
+func (c *valueCache) SetContext(ctx context.Context, key, value []byte, expiration time.Duration) error {
+	data, err := c.codec.encodeValue(key, value)
+	if err != nil {
+		return err
+	}
+	return WithContext(c.cache).Set(ctx, key, data, expiration)
+}
+
+// DeleteContext delete key with context.
+func (c *valueCache) DeleteContext(ctx context.Context, key []byte) (bool, error) {
+	return WithContext(c.cache).Delete(ctx, key)
+}
+
+// ActiveContext active key with context.
+func (c *valueCache) ActiveContext(ctx context.Context, key []byte, expiration time.Duration) error {
+	return WithContext(c.cache).Active(ctx, key, expiration)
+}
+
+// MGet 批量查询并还原 value.
+func (c *valueCache) MGet(keys [][]byte) []Result {
+	results := MGet(c.cache, keys)
+	for idx := range results {
+		if results[idx].Err == nil {
+			results[idx].Value, results[idx].Err = c.codec.decodeValue(results[idx].Key, results[idx].Value)
+		}
+	}
+	return results
+}
+
+// MSet 转换 value 后批量写入.
+func (c *valueCache) MSet(items []Item) []error {
+	errs := make([]error, len(items))
+	encoded := make([]Item, 0, len(items))
+	index := make([]int, 0, len(items))
+	for idx, item := range items {
+		data, err := c.codec.encodeValue(item.Key, item.Value)
+		if err != nil {
+			errs[idx] = err
+			continue
+		}
+		encoded = append(encoded, Item{Key: item.Key, Value: data, Expiration: item.Expiration})
+		index = append(index, idx)
+	}
+	for idx, err := range MSet(c.cache, encoded) {
+		errs[index[idx]] = err
+	}
+	return errs
+}
+
+// MDelete 批量删除.
+func (c *valueCache) MDelete(keys [][]byte) []bool {
+	return MDelete(c.cache, keys)
+}
+
+// Stats 后端的统计信息, BytesUsed 为转换后的大小.
+func (c *valueCache) Stats() (Stats, error) {
+	sc, ok := c.cache.(StatsCache)
+	if !ok {
+		return Stats{}, fmt.Errorf("%w: %T Stats", ErrNotSupported, c.cache)
+	}
+	return sc.Stats()
+}
+
+// TTL key 的剩余过期时间.
+func (c *valueCache) TTL(key []byte) (time.Duration, error) {
+	ic, ok := c.cache.(InspectCache)
+	if !ok {
+		return 0, fmt.Errorf("%w: %T TTL", ErrNotSupported, c.cache)
+	}
+	return ic.TTL(key)
+}
+
+// Exists key是否存在, 后端不支持时通过 Get 判断.
+func (c *valueCache) Exists(key []byte) bool {
+	if ic, ok := c.cache.(InspectCache); ok {
+		return ic.Exists(key)
+	}
+	_, err := c.cache.Get(key)
+	return err == nil
+}
+
+// peek 从后端读取并还原 value, 后端不支持 peek 时使用 TTL 和 Get.
+func (c *valueCache) peek(key []byte) ([]byte, int64, error) {
+	var data []byte
+	var deadline int64
+	if pc, ok := c.cache.(peekCache); ok {
+		var err error
+		if data, deadline, err = pc.peek(key); err != nil {
+			return nil, 0, err
+		}
+	} else {
+		ttl, err := c.TTL(key)
+		if err != nil {
+			return nil, 0, err
+		}
+		if data, err = c.cache.Get(key); err != nil {
+			return nil, 0, err
+		}
+		if ttl > 0 {
+			deadline = time.Now().Add(ttl).UnixNano()
+		}
+	}
+	value, err := c.codec.decodeValue(key, data)
+	return value, deadline, err
+}
+
+// checkSnapshot 后端不支持快照时包装后同样不支持.
+func (c *valueCache) checkSnapshot() error {
+	if sc, ok := c.cache.(snapshotChecker); ok {
+		return sc.checkSnapshot()
+	}
+	return nil
+}
+
+// Clear 清空后端.
+func (c *valueCache) Clear() error {
+	ic, ok := c.cache.(InspectCache)
+	if !ok {
+		return fmt.Errorf("%w: %T Clear", ErrNotSupported, c.cache)
+	}
+	return ic.Clear()
+}
+
+// Range 遍历后端的key.
+func (c *valueCache) Range(fn func(key []byte) bool) error {
+	ic, ok := c.cache.(InspectCache)
+	if !ok {
+		return fmt.Errorf("%w: %T Range", ErrNotSupported, c.cache)
+	}
+	return ic.Range(fn)
+}
+
+// Close 关闭后端, 例如 memory/freecache 在关闭时保存快照.
+func (c *valueCache) Close() error {
+	if closer, ok := c.cache.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
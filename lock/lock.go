@@ -0,0 +1,205 @@
+// Package lock 提供分布式锁和租约的能力.
+// 锁保存在 Backend 中, 目前支持 redis, 关系型数据库和内存(用于测试).
+// 每次获取锁都会返回单调递增的 fencing token, 写入下游存储时携带 token, 下游拒绝比已见过的 token 更小的请求,
+// 即可避免持有者因为 GC 停顿等原因租约过期后继续写入.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotAcquired 锁已被其他持有者持有
+	ErrNotAcquired = errors.New("lock: not acquired")
+	// ErrNotHeld 锁已过期或已被其他持有者获取, 续约和释放时返回
+	ErrNotHeld = errors.New("lock: not held")
+	// ErrInvalidTTL 租约小于 minttl, redis 的过期时间精度为毫秒
+	ErrInvalidTTL = errors.New("lock: ttl must be at least 1ms")
+)
+
+const (
+	minttl               = time.Millisecond
+	defaultttl           = 30 * time.Second
+	defaultretryinterval = 100 * time.Millisecond
+)
+
+// Backend 锁的存储.
+type Backend interface {
+	// Acquire 获取锁, 已被持有时返回 ErrNotAcquired, 成功时返回 fencing token.
+	Acquire(ctx context.Context, key, owner string, ttl time.Duration) (token uint64, err error)
+	// Renew 续约, 锁不属于 owner 时返回 ErrNotHeld.
+	Renew(ctx context.Context, key, owner string, ttl time.Duration) error
+	// Release 释放锁, 锁不属于 owner 时返回 ErrNotHeld.
+	Release(ctx context.Context, key, owner string) error
+}
+
+// Locker 基于 Backend 获取锁.
+type Locker struct {
+	backend       Backend
+	ttl           time.Duration
+	retryinterval time.Duration
+}
+
+// NewLocker new locker, 默认租约 30s, 重试间隔 100ms.
+func NewLocker(backend Backend) *Locker {
+	return &Locker{
+		backend:       backend,
+		ttl:           defaultttl,
+		retryinterval: defaultretryinterval,
+	}
+}
+
+// WithTTL set lease ttl, 小于 1ms 时获取锁返回 ErrInvalidTTL.
+func (l *Locker) WithTTL(ttl time.Duration) *Locker {
+	l.ttl = ttl
+	return l
+}
+
+// WithRetryInterval set Lock retry interval.
+func (l *Locker) WithRetryInterval(interval time.Duration) *Locker {
+	l.retryinterval = interval
+	return l
+}
+
+// TryLock 尝试获取锁, 已被持有时立即返回 ErrNotAcquired.
+func (l *Locker) TryLock(ctx context.Context, key string) (*Lease, error) {
+	if l.ttl < minttl {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTTL, l.ttl)
+	}
+	owner, err := newOwner()
+	if err != nil {
+		return nil, err
+	}
+	token, err := l.backend.Acquire(ctx, key, owner, l.ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{
+		Key:     key,
+		Token:   token,
+		owner:   owner,
+		ttl:     l.ttl,
+		backend: l.backend,
+		expires: time.Now().Add(l.ttl),
+	}, nil
+}
+
+// Lock 获取锁, 已被持有时按重试间隔重试, 直到获取成功或 ctx 结束.
+func (l *Locker) Lock(ctx context.Context, key string) (*Lease, error) {
+	ticker := time.NewTicker(l.retryinterval)
+	defer ticker.Stop()
+	for {
+		lease, err := l.TryLock(ctx, key)
+		if err != nil && ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %w", ErrNotAcquired, ctx.Err())
+		}
+		if !errors.Is(err, ErrNotAcquired) {
+			return lease, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ErrNotAcquired, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Lease 持有中的锁.
+type Lease struct {
+	// Key 锁的名称
+	Key string
+	// Token fencing token, 同一个 key 每次获取锁单调递增
+	Token uint64
+
+	owner   string
+	ttl     time.Duration
+	backend Backend
+
+	mutex   sync.Mutex
+	expires time.Time
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Expires 本地记录的租约过期时间.
+func (l *Lease) Expires() time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.expires
+}
+
+// Renew 续约, 租约已丢失时返回 ErrNotHeld.
+func (l *Lease) Renew(ctx context.Context) error {
+	start := time.Now()
+	if err := l.backend.Renew(ctx, l.Key, l.owner, l.ttl); err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	l.expires = start.Add(l.ttl)
+	l.mutex.Unlock()
+	return nil
+}
+
+// KeepAlive 后台每隔 ttl/3 续约, 直到 Unlock 或 ctx 结束.
+// 续约失败时停止续约, 并将错误写入返回的 channel, 持有者应当停止依赖锁的操作.
+func (l *Lease) KeepAlive(ctx context.Context) <-chan error {
+	errs := make(chan error, 1)
+	l.mutex.Lock()
+	if l.stop != nil {
+		l.mutex.Unlock()
+		errs <- errors.New("lock: keepalive already started")
+		return errs
+	}
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	stop, done := l.stop, l.done
+	l.mutex.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := l.Renew(ctx); err != nil && ctx.Err() == nil {
+					errs <- err
+					return
+				}
+			}
+		}
+	}()
+	return errs
+}
+
+// Unlock 停止续约并释放锁, 锁已被其他持有者获取时返回 ErrNotHeld, 不会释放其他持有者的锁.
+func (l *Lease) Unlock(ctx context.Context) error {
+	l.mutex.Lock()
+	stop, done := l.stop, l.done
+	l.stop = nil
+	l.mutex.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return l.backend.Release(ctx, l.Key, l.owner)
+}
+
+// newOwner 生成随机的持有者标识.
+func newOwner() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,129 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// testBackend elapse 让后端的时间前进, miniredis 需要手动 FastForward.
+func testBackend(t *testing.T, backend Backend, elapse func(d time.Duration)) {
+	ctx := context.Background()
+	locker := NewLocker(backend).WithTTL(200 * time.Millisecond).WithRetryInterval(10 * time.Millisecond)
+
+	lease, err := locker.TryLock(ctx, "job")
+	assert.Equal(t, err, nil)
+	_, err = locker.TryLock(ctx, "job")
+	assert.Equal(t, err, ErrNotAcquired)
+	other, err := locker.TryLock(ctx, "other")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, other.Unlock(ctx), nil)
+
+	assert.Equal(t, lease.Renew(ctx), nil)
+	assert.Equal(t, lease.Unlock(ctx), nil)
+	assert.Equal(t, lease.Unlock(ctx), ErrNotHeld)
+
+	// 租约过期后被其他持有者获取, 旧的持有者不能续约和释放
+	next, err := locker.TryLock(ctx, "job")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, next.Token > lease.Token, true)
+	elapse(300 * time.Millisecond)
+	last, err := locker.Lock(ctx, "job")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, last.Token > next.Token, true)
+	assert.Equal(t, next.Renew(ctx), ErrNotHeld)
+	assert.Equal(t, next.Unlock(ctx), ErrNotHeld)
+
+	// Lock 等待锁释放
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = last.Unlock(ctx)
+	}()
+	waited, err := locker.Lock(ctx, "job")
+	assert.Equal(t, err, nil)
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = locker.Lock(timeout, "job")
+	assert.Equal(t, errors.Is(err, ErrNotAcquired), true)
+	assert.Equal(t, errors.Is(err, context.DeadlineExceeded), true)
+
+	// KeepAlive 保持租约直到 Unlock
+	errs := waited.KeepAlive(ctx)
+	time.Sleep(400 * time.Millisecond)
+	_, err = locker.TryLock(ctx, "job")
+	assert.Equal(t, err, ErrNotAcquired)
+	assert.Equal(t, waited.Unlock(ctx), nil)
+	select {
+	case err = <-errs:
+		t.Fatalf("unexpected keepalive error: %v", err)
+	default:
+	}
+}
+
+func TestMemoryBackend(t *testing.T) {
+	testBackend(t, NewMemoryBackend(), time.Sleep)
+}
+
+func TestLockMutualExclusion(t *testing.T) {
+	ctx := context.Background()
+	locker := NewLocker(NewMemoryBackend()).WithRetryInterval(time.Millisecond)
+	var wg sync.WaitGroup
+	var counter, running int
+	var mutex sync.Mutex
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				lease, err := locker.Lock(ctx, "counter")
+				assert.Equal(t, err, nil)
+				mutex.Lock()
+				running++
+				assert.Equal(t, running, 1)
+				running--
+				counter++
+				mutex.Unlock()
+				assert.Equal(t, lease.Unlock(ctx), nil)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, counter, 100)
+}
+
+func TestKeepAliveLost(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+	lease, err := NewLocker(backend).WithTTL(60*time.Millisecond).TryLock(ctx, "job")
+	assert.Equal(t, err, nil)
+	errs := lease.KeepAlive(ctx)
+	assert.Equal(t, errors.Is(<-lease.KeepAlive(ctx), nil), false)
+
+	// 模拟锁被强制删除
+	backend.mutex.Lock()
+	delete(backend.locks, "job")
+	backend.mutex.Unlock()
+	select {
+	case err = <-errs:
+		assert.Equal(t, err, ErrNotHeld)
+	case <-time.After(time.Second):
+		t.Fatal("keepalive not failed")
+	}
+	assert.Equal(t, lease.Unlock(ctx), ErrNotHeld)
+}
+
+func TestLockInvalidTTL(t *testing.T) {
+	ctx := context.Background()
+	for _, ttl := range []time.Duration{0, time.Nanosecond, 999 * time.Microsecond} {
+		locker := NewLocker(NewMemoryBackend()).WithTTL(ttl)
+		_, err := locker.TryLock(ctx, "job")
+		assert.Equal(t, errors.Is(err, ErrInvalidTTL), true)
+		_, err = locker.Lock(ctx, "job")
+		assert.Equal(t, errors.Is(err, ErrInvalidTTL), true)
+	}
+}
@@ -0,0 +1,80 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryBackend 进程内的锁, 用于测试和单实例部署.
+type MemoryBackend struct {
+	mutex  sync.Mutex
+	locks  map[string]memoryLock
+	tokens map[string]uint64
+}
+
+type memoryLock struct {
+	owner   string
+	expires time.Time
+}
+
+// NewMemoryBackend new memory backend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		locks:  make(map[string]memoryLock),
+		tokens: make(map[string]uint64),
+	}
+}
+
+// Acquire lock.
+func (b *MemoryBackend) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.held(key); ok {
+		return 0, ErrNotAcquired
+	}
+	b.tokens[key]++
+	b.locks[key] = memoryLock{owner: owner, expires: time.Now().Add(ttl)}
+	return b.tokens[key], nil
+}
+
+// Renew lock.
+func (b *MemoryBackend) Renew(ctx context.Context, key, owner string, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if lock, ok := b.held(key); !ok || lock.owner != owner {
+		return ErrNotHeld
+	}
+	b.locks[key] = memoryLock{owner: owner, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// Release lock.
+func (b *MemoryBackend) Release(ctx context.Context, key, owner string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if lock, ok := b.held(key); !ok || lock.owner != owner {
+		return ErrNotHeld
+	}
+	delete(b.locks, key)
+	return nil
+}
+
+// held 返回未过期的锁.
+func (b *MemoryBackend) held(key string) (memoryLock, bool) {
+	lock, ok := b.locks[key]
+	if ok && time.Now().After(lock.expires) {
+		delete(b.locks, key)
+		return lock, false
+	}
+	return lock, ok
+}
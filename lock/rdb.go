@@ -0,0 +1,130 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/mmtbak/microlibrary/rdb"
+	"gorm.io/gorm"
+)
+
+// LockRecord 锁在数据库中的记录, 使用前通过 DBClient.SyncTables([]any{&LockRecord{}}) 创建表.
+// Owner 为空表示锁已释放, Token 每次获取锁递增, 作为 fencing token.
+type LockRecord struct {
+	Name      string `gorm:"primaryKey;size:191"`
+	Owner     string `gorm:"size:64"`
+	Token     uint64
+	ExpiresAt time.Time
+}
+
+// TableName table name.
+func (LockRecord) TableName() string {
+	return "distributed_locks"
+}
+
+// RDBBackend 基于关系型数据库的锁, 获取锁时使用 rdb.ForUpdate 锁定记录.
+// 过期时间使用本地时钟判断, 各实例之间的时钟偏差需要远小于 ttl.
+type RDBBackend struct {
+	client *rdb.DBClient
+}
+
+// NewRDBBackend new rdb backend.
+func NewRDBBackend(client *rdb.DBClient) *RDBBackend {
+	return &RDBBackend{client: client}
+}
+
+// Acquire lock.
+func (b *RDBBackend) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (token uint64, err error) {
+	err = b.client.DB().WithContext(ctx).Transaction(func(tx rdb.Tx) error {
+		var record LockRecord
+		now := time.Now()
+		err := rdb.ForUpdate(tx).Where("name = ?", key).Take(&record).Error
+		if rdb.IsErrRecordNotFound(err) {
+			record = LockRecord{Name: key, Owner: owner, Token: 1, ExpiresAt: now.Add(ttl)}
+			err = tx.Create(&record).Error
+			token = record.Token
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if record.Owner != "" && record.ExpiresAt.After(now) {
+			return ErrNotAcquired
+		}
+		token = record.Token + 1
+		return tx.Model(&LockRecord{}).Where("name = ?", key).Updates(map[string]any{
+			"owner":      owner,
+			"token":      token,
+			"expires_at": now.Add(ttl),
+		}).Error
+	})
+	if isConflict(err) {
+		return 0, ErrNotAcquired
+	}
+	if err != nil {
+		return 0, err
+	}
+	return token, nil
+}
+
+// isConflict 其它实例同时获取同一个锁引起的错误: 并发插入记录时主键冲突, 死锁或序列化失败,
+// 说明锁正在被其它实例获取, 按未获取到锁处理.
+// 识别 mysql 的错误码, 以及实现了 SQLState() string 的驱动错误(pgx, lib/pq)的 SQLSTATE;
+// 其它驱动(例如 sqlite)只能通过 gorm 的 TranslateError 转换为 gorm.ErrDuplicatedKey 识别主键冲突.
+func isConflict(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	var mysqlerr *mysql.MySQLError
+	if errors.As(err, &mysqlerr) {
+		return mysqlerr.Number == mysqlDuplicateEntry || mysqlerr.Number == mysqlDeadlock ||
+			string(mysqlerr.SQLState[:]) == sqlstateSerializationFailure
+	}
+	var stateerr interface{ SQLState() string }
+	if errors.As(err, &stateerr) {
+		switch stateerr.SQLState() {
+		case sqlstateUniqueViolation, sqlstateDeadlockDetected, sqlstateSerializationFailure:
+			return true
+		}
+	}
+	return false
+}
+
+// mysql 错误码和 SQLSTATE
+const (
+	mysqlDuplicateEntry          = 1062
+	mysqlDeadlock                = 1213
+	sqlstateUniqueViolation      = "23505"
+	sqlstateDeadlockDetected     = "40P01"
+	sqlstateSerializationFailure = "40001"
+)
+
+// Renew lock.
+func (b *RDBBackend) Renew(ctx context.Context, key, owner string, ttl time.Duration) error {
+	now := time.Now()
+	return b.update(ctx, key, owner, now, map[string]any{"expires_at": now.Add(ttl)})
+}
+
+// Release lock.
+func (b *RDBBackend) Release(ctx context.Context, key, owner string) error {
+	now := time.Now()
+	return b.update(ctx, key, owner, now, map[string]any{"owner": "", "expires_at": now})
+}
+
+// update 更新 owner 持有且未过期的锁, 没有匹配的记录时返回 ErrNotHeld.
+func (b *RDBBackend) update(ctx context.Context, key, owner string, now time.Time, values map[string]any) error {
+	result := b.client.Session().WithContext(ctx).Model(&LockRecord{}).
+		Where("name = ? AND owner = ? AND expires_at > ?", key, owner, now).Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
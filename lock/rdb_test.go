@@ -0,0 +1,106 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/mmtbak/microlibrary/rdb"
+	"gopkg.in/go-playground/assert.v1"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestRDBBackend(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Equal(t, err, nil)
+	mock.ExpectQuery("SELECT VERSION()").WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("5.7.30"))
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{Conn: db}), &gorm.Config{})
+	assert.Equal(t, err, nil)
+	backend := NewRDBBackend((&rdb.DBClient{}).WithDB(gormDB))
+	ctx := context.Background()
+	columns := []string{"name", "owner", "token", "expires_at"}
+
+	// 记录不存在时插入
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `distributed_locks` WHERE name = \\? LIMIT 1 FOR UPDATE").
+		WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectExec("INSERT INTO `distributed_locks`").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	token, err := backend.Acquire(ctx, "job", "owner1", time.Minute)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, token, uint64(1))
+
+	// 锁被持有时回滚
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `distributed_locks`").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("job", "owner1", 1, time.Now().Add(time.Minute)))
+	mock.ExpectRollback()
+	_, err = backend.Acquire(ctx, "job", "owner2", time.Minute)
+	assert.Equal(t, err, ErrNotAcquired)
+
+	// 并发插入时主键冲突, 以及死锁, 按未获取到锁处理
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `distributed_locks`").WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectExec("INSERT INTO `distributed_locks`").
+		WillReturnError(&mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'job' for key 'PRIMARY'"})
+	mock.ExpectRollback()
+	_, err = backend.Acquire(ctx, "job", "owner2", time.Minute)
+	assert.Equal(t, err, ErrNotAcquired)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `distributed_locks`").
+		WillReturnError(&mysqldriver.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"})
+	mock.ExpectRollback()
+	_, err = backend.Acquire(ctx, "job", "owner2", time.Minute)
+	assert.Equal(t, err, ErrNotAcquired)
+
+	// 锁已过期时更新 owner 并递增 token
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `distributed_locks`").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("job", "owner1", 3, time.Now().Add(-time.Second)))
+	mock.ExpectExec("UPDATE `distributed_locks` SET").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	token, err = backend.Acquire(ctx, "job", "owner2", time.Minute)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, token, uint64(4))
+
+	// 续约和释放只更新 owner 持有且未过期的记录
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `distributed_locks` SET `expires_at`=\\? WHERE name = \\? AND owner = \\? AND expires_at > \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.Equal(t, backend.Renew(ctx, "job", "owner2", time.Minute), nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `distributed_locks` SET").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	assert.Equal(t, backend.Release(ctx, "job", "owner1"), ErrNotHeld)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `distributed_locks` SET `expires_at`=\\?,`owner`=\\?").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.Equal(t, backend.Release(ctx, "job", "owner2"), nil)
+
+	assert.Equal(t, mock.ExpectationsWereMet(), nil)
+}
+
+// sqlStateError 模拟实现了 SQLState() 的驱动错误, 例如 pgx 的 PgError.
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sqlstate " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestIsConflict(t *testing.T) {
+	assert.Equal(t, isConflict(nil), false)
+	assert.Equal(t, isConflict(gorm.ErrDuplicatedKey), true)
+	assert.Equal(t, isConflict(&mysqldriver.MySQLError{Number: 1062}), true)
+	assert.Equal(t, isConflict(&mysqldriver.MySQLError{Number: 1213}), true)
+	assert.Equal(t, isConflict(&mysqldriver.MySQLError{Number: 1146}), false)
+	assert.Equal(t, isConflict(sqlStateError("23505")), true)
+	assert.Equal(t, isConflict(sqlStateError("40P01")), true)
+	assert.Equal(t, isConflict(sqlStateError("40001")), true)
+	assert.Equal(t, isConflict(sqlStateError("42P01")), false)
+}
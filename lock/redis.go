@@ -0,0 +1,86 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 锁的 key 使用 hash tag, 保证 cluster 模式下锁和 fencing token 计数器在同一个 slot.
+var (
+	redisAcquireScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0`)
+	redisRenewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+	redisReleaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// RedisBackend 基于 redis SET NX PX 的锁, fencing token 保存在不过期的计数器中.
+type RedisBackend struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisBackend new redis backend, 可以使用 cache.RedisCache.Client() 复用缓存的连接.
+func NewRedisBackend(client redis.UniversalClient) *RedisBackend {
+	return &RedisBackend{client: client, prefix: "lock:"}
+}
+
+// WithPrefix set key prefix, 默认 "lock:".
+func (b *RedisBackend) WithPrefix(prefix string) *RedisBackend {
+	b.prefix = prefix
+	return b
+}
+
+// Acquire lock.
+func (b *RedisBackend) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (uint64, error) {
+	lockkey := b.key(key)
+	token, err := redisAcquireScript.Run(ctx, b.client, []string{lockkey, lockkey + ":token"},
+		owner, ttl.Milliseconds()).Uint64()
+	if err != nil {
+		return 0, err
+	}
+	if token == 0 {
+		return 0, ErrNotAcquired
+	}
+	return token, nil
+}
+
+// Renew lock.
+func (b *RedisBackend) Renew(ctx context.Context, key, owner string, ttl time.Duration) error {
+	ok, err := redisRenewScript.Run(ctx, b.client, []string{b.key(key)}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Release lock.
+func (b *RedisBackend) Release(ctx context.Context, key, owner string) error {
+	ok, err := redisReleaseScript.Run(ctx, b.client, []string{b.key(key)}, owner).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+func (b *RedisBackend) key(key string) string {
+	return "{" + b.prefix + key + "}"
+}
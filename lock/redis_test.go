@@ -0,0 +1,29 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestRedisBackend(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	testBackend(t, NewRedisBackend(client), func(d time.Duration) {
+		time.Sleep(d)
+		server.FastForward(d)
+	})
+
+	backend := NewRedisBackend(client).WithPrefix("svc:lock:")
+	lease, err := NewLocker(backend).TryLock(context.Background(), "job")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, server.Exists("{svc:lock:job}"), true)
+	assert.Equal(t, lease.Token, uint64(1))
+	assert.Equal(t, lease.Unlock(context.Background()), nil)
+	assert.Equal(t, server.Exists("{svc:lock:job}"), false)
+}
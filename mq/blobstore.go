@@ -0,0 +1,199 @@
+package mq
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/pkg/errors"
+)
+
+// claimCheckHeader 消息头, 值为消息体在blob store中的key
+const claimCheckHeader = "x-claim-check"
+
+// ErrBlobNotFound blob 不存在, BlobStore.Get 需要返回此错误(可以wrap), 消费时据此跳过无法恢复的消息.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore 大消息体存储接口, 用于 claim check 模式.
+// 消息体超过阈值时存入 BlobStore, kafka消息只携带key, 消费时自动取回.
+// blob 的清理由存储自身负责, 因为同一个blob可能被多个topic/消费者组读取,
+// 例如对象存储的生命周期规则, LocalBlobStore 需要调用方定期执行 Prune.
+type BlobStore interface {
+	// Put 保存数据
+	Put(key string, data []byte) error
+	// Get 读取数据, 不存在时返回 ErrBlobNotFound
+	Get(key string) ([]byte, error)
+	// Delete 删除数据
+	Delete(key string) error
+}
+
+// LocalBlobStore 本地文件系统实现的 BlobStore.
+// 不会自动删除数据, 调用方需要定期调用 Prune 清理超过topic保留时间的blob, 否则目录会持续增长.
+type LocalBlobStore struct {
+	Dir string
+}
+
+// NewLocalBlobStore 创建本地 BlobStore, 目录不存在时自动创建
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "create blob dir failed")
+	}
+	return &LocalBlobStore{Dir: dir}, nil
+}
+
+// Put 先写临时文件再重命名, 避免读到不完整的数据
+func (s *LocalBlobStore) Put(key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Get 读取数据, 文件不存在时返回 ErrBlobNotFound
+func (s *LocalBlobStore) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errors.Wrap(ErrBlobNotFound, key)
+	}
+	return data, err
+}
+
+// Delete 删除数据, 不存在时不报错
+func (s *LocalBlobStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Prune 删除修改时间早于 maxAge 之前的blob, 返回删除的数量.
+// maxAge 应大于topic的保留时间, 保证消费者读取消息时blob仍然存在.
+func (s *LocalBlobStore) Prune(maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return 0, err
+	}
+	deadline := time.Now().Add(-maxAge)
+	var count int
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return count, err
+		}
+		if !info.ModTime().Before(deadline) {
+			continue
+		}
+		err = os.Remove(filepath.Join(s.Dir, entry.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || key == "." || key == ".." {
+		return "", fmt.Errorf("invalid blob key '%s'", key)
+	}
+	return filepath.Join(s.Dir, key), nil
+}
+
+// SetClaimCheck set blob store and threshold, message body larger than threshold bytes
+// will be stored in blob store and the message only carries a reference
+func (mq *KafkaMessageQueue) SetClaimCheck(store BlobStore, threshold int) {
+	mq.blobStore = store
+	mq.config.ClaimCheckBytes = threshold
+}
+
+// BlobStore blob store of claim check, 为nil时未开启.
+func (mq *KafkaMessageQueue) BlobStore() BlobStore {
+	return mq.blobStore
+}
+
+// claimCheck 消息体超过阈值时存入blob store, 消息体替换为blob key
+func (mq *KafkaMessageQueue) claimCheck(producerMsg *sarama.ProducerMessage, msg []byte) error {
+	if mq.blobStore == nil || mq.config == nil || mq.config.ClaimCheckBytes <= 0 ||
+		len(msg) <= mq.config.ClaimCheckBytes {
+		return nil
+	}
+	key, err := newBlobKey()
+	if err != nil {
+		return err
+	}
+	if err = mq.blobStore.Put(key, msg); err != nil {
+		return errors.Wrap(err, "put message to blob store failed")
+	}
+	producerMsg.Value = sarama.StringEncoder(key)
+	producerMsg.Headers = append(producerMsg.Headers, sarama.RecordHeader{
+		Key:   []byte(claimCheckHeader),
+		Value: []byte(key),
+	})
+	return nil
+}
+
+// discardClaimCheck 消息没有发送成功时删除已写入的blob
+func (mq *KafkaMessageQueue) discardClaimCheck(producerMsg *sarama.ProducerMessage) {
+	for _, header := range producerMsg.Headers {
+		if string(header.Key) != claimCheckHeader {
+			continue
+		}
+		if err := mq.blobStore.Delete(string(header.Value)); err != nil {
+			mq.logger.Warn("kafka delete unsent blob failed", "key", string(header.Value), "error", err)
+		}
+	}
+}
+
+// resolveClaimCheck 消息携带claim check引用时, 从blob store取回消息体
+func (mq *KafkaMessageQueue) resolveClaimCheck(message *sarama.ConsumerMessage) error {
+	if message == nil {
+		return nil
+	}
+	for _, header := range message.Headers {
+		if header == nil || string(header.Key) != claimCheckHeader {
+			continue
+		}
+		if mq.blobStore == nil {
+			return errors.New("message is claim checked but blob store is not configured")
+		}
+		data, err := mq.blobStore.Get(string(header.Value))
+		if err != nil {
+			return errors.Wrap(err, "get message from blob store failed")
+		}
+		message.Value = data
+		return nil
+	}
+	return nil
+}
+
+func newBlobKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,198 @@
+package mq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestLocalBlobStore(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	assert.Equal(t, err, nil)
+
+	err = store.Put("key1", []byte("value1"))
+	assert.Equal(t, err, nil)
+	data, err := store.Get("key1")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(data), "value1")
+
+	err = store.Delete("key1")
+	assert.Equal(t, err, nil)
+	_, err = store.Get("key1")
+	assert.NotEqual(t, err, nil)
+
+	err = store.Put("../key1", []byte("value1"))
+	assert.NotEqual(t, err, nil)
+}
+
+func TestKafkaClaimCheck(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	assert.Equal(t, err, nil)
+	largemsg := bytes.Repeat([]byte("a"), 1024)
+
+	var sent *sarama.ProducerMessage
+	mockproducer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	mockproducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		sent = msg
+		return nil
+	})
+	kafkamq := &KafkaMessageQueue{
+		producer: mockproducer,
+		topics:   []string{"topic-a"},
+		config:   NewDefaultKafkaConfig(),
+		logger:   slog.Default(),
+	}
+	kafkamq.SetClaimCheck(store, 512)
+
+	err = kafkamq.SendMessage(largemsg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(sent.Headers), 1)
+	assert.Equal(t, string(sent.Headers[0].Key), claimCheckHeader)
+
+	// 消费时取回消息体
+	key, _ := sent.Value.Encode()
+	message := &sarama.ConsumerMessage{
+		Value:   key,
+		Headers: []*sarama.RecordHeader{&sent.Headers[0]},
+	}
+	err = kafkamq.resolveClaimCheck(message)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, bytes.Equal(message.Value, largemsg), true)
+}
+
+func TestLocalBlobStorePrune(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, store.Put("old", []byte("value")), nil)
+	assert.Equal(t, store.Put("new", []byte("value")), nil)
+	past := time.Now().Add(-2 * time.Hour)
+	assert.Equal(t, os.Chtimes(filepath.Join(store.Dir, "old"), past, past), nil)
+
+	count, err := store.Prune(time.Hour)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, count, 1)
+	_, err = store.Get("old")
+	assert.NotEqual(t, err, nil)
+	_, err = store.Get("new")
+	assert.Equal(t, err, nil)
+}
+
+// markConsumerGroupSession 记录被标记的消息, ctx 结束时 ConsumeClaim 返回
+type markConsumerGroupSession struct {
+	mockConsumerGroupSession
+	ctx    context.Context
+	marked []*sarama.ConsumerMessage
+}
+
+func (s *markConsumerGroupSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, msg)
+}
+func (s *markConsumerGroupSession) Context() context.Context { return s.ctx }
+
+// mockConsumerGroupClaim 模拟分区
+type mockConsumerGroupClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *mockConsumerGroupClaim) Topic() string                            { return "topic-a" }
+func (c *mockConsumerGroupClaim) Partition() int32                         { return 0 }
+func (c *mockConsumerGroupClaim) InitialOffset() int64                     { return 0 }
+func (c *mockConsumerGroupClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *mockConsumerGroupClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func TestKafkaClaimCheckMissingBlob(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	assert.Equal(t, err, nil)
+	var failed *sarama.ConsumerMessage
+	kafkamq := &KafkaMessageQueue{
+		config: NewDefaultKafkaConfig(),
+		logger: slog.Default(),
+	}
+	kafkamq.SetClaimCheck(store, 512)
+	kafkamq.SetConsumerOption(NewKafkaConsumerOption().
+		WithOnClaimCheckError(func(message *sarama.ConsumerMessage, err error) {
+			failed = message
+		}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &markConsumerGroupSession{ctx: ctx}
+	claim := &mockConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	handler := &kafkaConsumerGroupHandler{queue: kafkamq, msg: make(chan Message, 1)}
+
+	// blob 不存在的消息被跳过, 后续消息正常消费
+	poison := &sarama.ConsumerMessage{Topic: "topic-a", Offset: 1, Headers: []*sarama.RecordHeader{
+		{Key: []byte(claimCheckHeader), Value: []byte("missing")},
+	}}
+	claim.messages <- poison
+	claim.messages <- &sarama.ConsumerMessage{Topic: "topic-a", Offset: 2, Value: []byte("value")}
+	done := make(chan error)
+	go func() { done <- handler.ConsumeClaim(session, claim) }()
+
+	msg := <-handler.msg
+	assert.Equal(t, string(msg.Body()), "value")
+	cancel()
+	assert.Equal(t, <-done, nil)
+	assert.Equal(t, failed, poison)
+	assert.Equal(t, len(session.marked), 1)
+	assert.Equal(t, session.marked[0], poison)
+}
+
+// failingBlobStore 读取时返回暂时性错误
+type failingBlobStore struct {
+	*LocalBlobStore
+}
+
+func (s *failingBlobStore) Get(string) ([]byte, error) {
+	return nil, errors.New("too many open files")
+}
+
+func TestKafkaClaimCheckTransientError(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	assert.Equal(t, err, nil)
+	kafkamq := &KafkaMessageQueue{
+		config: NewDefaultKafkaConfig(),
+		logger: slog.Default(),
+	}
+	kafkamq.SetClaimCheck(&failingBlobStore{store}, 512)
+
+	session := &markConsumerGroupSession{ctx: context.Background()}
+	claim := &mockConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+	handler := &kafkaConsumerGroupHandler{queue: kafkamq, msg: make(chan Message, 1)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "topic-a", Offset: 1, Headers: []*sarama.RecordHeader{
+		{Key: []byte(claimCheckHeader), Value: []byte("key")},
+	}}
+	// 暂时性错误结束会话且不标记消息, 重新消费
+	assert.NotEqual(t, handler.ConsumeClaim(session, claim), nil)
+	assert.Equal(t, len(session.marked), 0)
+}
+
+func TestKafkaClaimCheckSendFailed(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalBlobStore(dir)
+	assert.Equal(t, err, nil)
+	mockproducer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	mockproducer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	kafkamq := &KafkaMessageQueue{
+		producer: mockproducer,
+		topics:   []string{"topic-a"},
+		config:   NewDefaultKafkaConfig(),
+		logger:   slog.Default(),
+	}
+	kafkamq.SetClaimCheck(store, 512)
+
+	err = kafkamq.SendMessage(bytes.Repeat([]byte("a"), 1024))
+	assert.NotEqual(t, err, nil)
+	// 发送失败时删除已写入的blob
+	entries, err := os.ReadDir(dir)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(entries), 0)
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/IBM/sarama"
 	"github.com/mmtbak/dsnparser"
@@ -21,6 +23,16 @@ type KafkaMessageQueue struct {
 	producer sarama.SyncProducer
 	consumer sarama.ConsumerGroup
 	logger   *slog.Logger
+	// consumerOption 消费者选项, 包含重平衡回调
+	consumerOption *KafkaConsumerOption
+	// producerMutex 保护producer的创建与重建
+	producerMutex sync.Mutex
+	// statusFunc 健康状态回调
+	statusFunc HealthStatusFunc
+	// blobStore 大消息体存储, 配合config.ClaimCheckBytes使用
+	blobStore BlobStore
+	// consuming 已调用 ReceiveMessage 开始消费
+	consuming atomic.Bool
 }
 
 // NewKafkaMessageQueue new message queue
@@ -50,19 +62,26 @@ func NewKafkaMessageQueue(source string) (*KafkaMessageQueue, error) {
 	// producer 发送时创建
 	// consumer group 消费时创建
 	kafkamq := &KafkaMessageQueue{
-		Source:   source,
-		config:   config,
-		dsn:      dsndata,
-		hosts:    hosts,
-		topics:   topics,
-		producer: nil,
-		consumer: nil,
-		logger:   slog.Default(),
+		Source:         source,
+		config:         config,
+		dsn:            dsndata,
+		hosts:          hosts,
+		topics:         topics,
+		producer:       nil,
+		consumer:       nil,
+		logger:         slog.Default(),
+		consumerOption: NewKafkaConsumerOption(),
+	}
+	if config.BlobPath != "" {
+		kafkamq.blobStore, err = NewLocalBlobStore(config.BlobPath)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Test Kafka connection
 	cfg := kafkamq.GenConfig()
-	clusteradmin, err := sarama.NewClusterAdmin(hosts, cfg)
+	clusteradmin, err := newClusterAdmin(hosts, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -88,13 +107,18 @@ func (mq *KafkaMessageQueue) SetLogger(l *slog.Logger) {
 	mq.logger = l
 }
 
+// SetConsumerOption set consumer option, must be called before ReceiveMessage
+func (mq *KafkaMessageQueue) SetConsumerOption(opt *KafkaConsumerOption) {
+	mq.consumerOption = opt
+}
+
 // CreateTopic  create topic if not exist
 // param topic name
 func (mq *KafkaMessageQueue) CreateTopic(topic string) error {
 	// Set broker configuration
 	var err error
 	cfg := mq.GenConfig()
-	clusteradmin, err := sarama.NewClusterAdmin(mq.hosts, cfg)
+	clusteradmin, err := newClusterAdmin(mq.hosts, cfg)
 	if err != nil {
 		return err
 	}
@@ -130,6 +154,8 @@ func (mq *KafkaMessageQueue) SyncSchema() error {
 
 func (mq *KafkaMessageQueue) newProducer() (sarama.SyncProducer, error) {
 	var err error
+	mq.producerMutex.Lock()
+	defer mq.producerMutex.Unlock()
 	if mq.producer == nil {
 		producerconfig := mq.GenConfig()
 		mq.producer, err = sarama.NewSyncProducer(mq.hosts, producerconfig)
@@ -167,16 +193,124 @@ func (mq *KafkaMessageQueue) GenConfig() *sarama.Config {
 	return config
 }
 
+// TopicSendResult 单个topic的发送结果
+type TopicSendResult struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
 // SendMessage implements
+// 如果生产者开启了事务(transactionid), 则全部topic在一个事务中发送, 保证原子性;
+// 否则按顺序发送, 遇到错误立即返回.
 func (mq *KafkaMessageQueue) SendMessage(msg []byte, opts ...*SendMsgOption) error {
+	_, err := mq.sendMessage(msg, true, opts...)
+	return err
+}
+
+// FanoutMessage 将消息发送到全部目标topic, 单个topic失败不影响其他topic, 返回每个topic的发送结果.
+// 如果生产者开启了事务, 则全部topic在一个事务中发送, 失败时所有结果都带有错误.
+func (mq *KafkaMessageQueue) FanoutMessage(msg []byte, opts ...*SendMsgOption) ([]TopicSendResult, error) {
+	return mq.sendMessage(msg, false, opts...)
+}
+
+func (mq *KafkaMessageQueue) sendMessage(msg []byte, stopOnError bool, opts ...*SendMsgOption) ([]TopicSendResult, error) {
 	opt := NewSendMsgOption()
 	if len(opts) > 0 {
 		opt = opts[0]
 	}
+	topics := mq.topics
+	if len(opt.Topics) > 0 {
+		topics = opt.Topics
+	}
+	template, err := mq.newProducerMessage(msg, opt)
+	if err != nil {
+		return nil, err
+	}
 	producer, err := mq.newProducer()
 	if err != nil {
-		return err
+		mq.discardClaimCheck(template)
+		return nil, err
+	}
+	results, err := mq.sendWithProducer(producer, template, stopOnError, topics)
+	if err != nil {
+		mq.recoverProducer(producer, results)
+		if !anySent(results) {
+			mq.discardClaimCheck(template)
+		}
 	}
+	return results, err
+}
+
+// anySent 是否有topic发送成功, 事务回滚时所有结果都带有错误
+func anySent(results []TopicSendResult) bool {
+	for _, result := range results {
+		if result.Err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (mq *KafkaMessageQueue) sendWithProducer(producer sarama.SyncProducer, template *sarama.ProducerMessage,
+	stopOnError bool, topics []string) ([]TopicSendResult, error) {
+	if producer.IsTransactional() {
+		return mq.sendInTransaction(producer, template, topics)
+	}
+
+	var failed int
+	results := make([]TopicSendResult, 0, len(topics))
+	for _, topic := range topics {
+		result := TopicSendResult{Topic: topic}
+		result.Partition, result.Offset, result.Err = producer.SendMessage(topicMessage(template, topic))
+		results = append(results, result)
+		if result.Err != nil {
+			if stopOnError {
+				return results, result.Err
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("kafka send message failed on %d/%d topics", failed, len(topics))
+	}
+	return results, nil
+}
+
+// sendInTransaction 在一个事务中将消息发送到全部topic, 事务生产者的消息必须在事务中发送
+func (mq *KafkaMessageQueue) sendInTransaction(producer sarama.SyncProducer, template *sarama.ProducerMessage,
+	topics []string) ([]TopicSendResult, error) {
+	results := make([]TopicSendResult, 0, len(topics))
+	abort := func(err error) ([]TopicSendResult, error) {
+		if aborterr := producer.AbortTxn(); aborterr != nil {
+			mq.logger.Error("kafka abort transaction failed", "error", aborterr)
+		}
+		for idx := range results {
+			results[idx].Err = err
+		}
+		return results, err
+	}
+
+	if err := producer.BeginTxn(); err != nil {
+		return nil, errors.Wrap(err, "kafka begin transaction failed")
+	}
+	for _, topic := range topics {
+		result := TopicSendResult{Topic: topic}
+		result.Partition, result.Offset, result.Err = producer.SendMessage(topicMessage(template, topic))
+		results = append(results, result)
+		if result.Err != nil {
+			return abort(result.Err)
+		}
+	}
+	if err := producer.CommitTxn(); err != nil {
+		return abort(errors.Wrap(err, "kafka commit transaction failed"))
+	}
+	return results, nil
+}
+
+// newProducerMessage 生成待发送消息的模板, 超过claim check阈值的消息体会存入blob store
+func (mq *KafkaMessageQueue) newProducerMessage(msg []byte, opt *SendMsgOption) (*sarama.ProducerMessage, error) {
 	producerMsg := &sarama.ProducerMessage{
 		Value: sarama.ByteEncoder(msg),
 	}
@@ -186,13 +320,22 @@ func (mq *KafkaMessageQueue) SendMessage(msg []byte, opts ...*SendMsgOption) err
 	if opt.Key != "" {
 		producerMsg.Key = sarama.StringEncoder(opt.Key)
 	}
-	for _, topic := range mq.topics {
-		producerMsg.Topic = topic
-		if _, _, err := producer.SendMessage(producerMsg); err != nil {
-			return err
-		}
+	if err := mq.claimCheck(producerMsg, msg); err != nil {
+		return nil, err
 	}
-	return err
+	return producerMsg, nil
+}
+
+// topicMessage 复制消息模板并指定topic
+func topicMessage(template *sarama.ProducerMessage, topic string) *sarama.ProducerMessage {
+	producerMsg := &sarama.ProducerMessage{
+		Topic:     topic,
+		Key:       template.Key,
+		Value:     template.Value,
+		Headers:   template.Headers,
+		Timestamp: template.Timestamp,
+	}
+	return producerMsg
 }
 
 // ReceiveMessage receive message
@@ -201,6 +344,7 @@ func (mq *KafkaMessageQueue) ReceiveMessage() (<-chan Message, error) {
 	if err != nil {
 		return nil, err
 	}
+	mq.consuming.Store(true)
 	handler := &kafkaConsumerGroupHandler{
 		queue: mq,
 		msg:   make(chan Message),
@@ -221,8 +365,12 @@ func (mq *KafkaMessageQueue) ReceiveMessage() (<-chan Message, error) {
 
 // Close mq
 func (mq *KafkaMessageQueue) Close() error {
-	if mq.producer != nil {
-		return mq.producer.Close()
+	mq.producerMutex.Lock()
+	producer := mq.producer
+	mq.producer = nil
+	mq.producerMutex.Unlock()
+	if producer != nil {
+		return producer.Close()
 	}
 	if mq.consumer != nil {
 		return mq.consumer.Close()
@@ -267,16 +415,30 @@ type kafkaConsumerGroupHandler struct {
 
 // Setup is run at the beginning of a new session, before ConsumeClaim
 func (h *kafkaConsumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
-	h.queue.logger.Info("kafka setup")
+	claims := session.Claims()
+	h.queue.logger.Info("kafka setup", "member", session.MemberID(),
+		"generation", session.GenerationID(), "claims", claims)
 	if h.msg == nil {
 		h.msg = make(chan Message)
 	}
+	if opt := h.queue.consumerOption; opt != nil && opt.OnAssigned != nil {
+		if err := opt.OnAssigned(claims); err != nil {
+			return errors.Wrap(err, "kafka on assigned")
+		}
+	}
 	return nil
 }
 
 // Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited
 func (h *kafkaConsumerGroupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
-	h.queue.logger.Info("kafka cleanup")
+	claims := session.Claims()
+	h.queue.logger.Info("kafka cleanup", "member", session.MemberID(),
+		"generation", session.GenerationID(), "claims", claims)
+	if opt := h.queue.consumerOption; opt != nil && opt.OnRevoked != nil {
+		if err := opt.OnRevoked(claims); err != nil {
+			return errors.Wrap(err, "kafka on revoked")
+		}
+	}
 	return nil
 }
 
@@ -287,6 +449,22 @@ func (h *kafkaConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSes
 	for {
 		select {
 		case message := <-msgchan:
+			if err := h.queue.resolveClaimCheck(message); err != nil {
+				if !errors.Is(err, ErrBlobNotFound) {
+					// 读取失败可能是暂时的, 不标记消息, 结束会话后从未提交的offset重新消费
+					h.queue.logger.Error("kafka resolve claim check failed", "error", err,
+						"topic", message.Topic, "partition", message.Partition, "offset", message.Offset)
+					return err
+				}
+				// blob 已不存在, 重试也不会成功, 交给回调后跳过, 避免反复消费同一条消息
+				h.queue.logger.Error("kafka claim check blob not found, skip message", "error", err,
+					"topic", message.Topic, "partition", message.Partition, "offset", message.Offset)
+				if opt := h.queue.consumerOption; opt != nil && opt.OnClaimCheckError != nil {
+					opt.OnClaimCheckError(message, err)
+				}
+				session.MarkMessage(message, "")
+				continue
+			}
 			msg := &KafkaMessage{
 				session: session,
 				msg:     message,
@@ -50,6 +50,22 @@ var configParseFuncs = map[string]configParseFunc{
 		config.Version, err = sarama.ParseKafkaVersion(val)
 		return err
 	},
+	"transactionid": func(config *KafkaConfig, val string) error {
+		config.TransactionID = val
+		return nil
+	},
+	"compression": func(config *KafkaConfig, val string) error {
+		return config.Compression.UnmarshalText([]byte(val))
+	},
+	"claimcheckbytes": func(config *KafkaConfig, val string) error {
+		var err error
+		config.ClaimCheckBytes, err = strconv.Atoi(val)
+		return err
+	},
+	"blobpath": func(config *KafkaConfig, val string) error {
+		config.BlobPath = val
+		return nil
+	},
 	"buffersize": func(config *KafkaConfig, val string) error {
 		var err error
 		config.ProducerBufferSize, err = strconv.Atoi(val)
@@ -69,6 +85,10 @@ type KafkaConfig struct {
 	Initial            int64         // 最新偏移消息
 	Version            sarama.KafkaVersion
 	ClientID           string
+	TransactionID      string                  // 事务ID, 非空时开启事务生产者, 多topic发送保证原子性
+	Compression        sarama.CompressionCodec // 压缩算法: none, gzip, snappy, lz4, zstd
+	ClaimCheckBytes    int                     // 消息体超过该大小时存入blob store, 消息只携带引用, 0表示不开启
+	BlobPath           string                  // 本地blob store目录
 }
 
 func NewDefaultKafkaConfig() *KafkaConfig {
@@ -110,6 +130,12 @@ func (c *KafkaConfig) GenConfig() *sarama.Config {
 	newconfig.Producer.RequiredAcks = sarama.WaitForAll
 	newconfig.Producer.Flush.Messages = c.ProducerBufferSize
 	newconfig.Producer.Flush.Frequency = c.ProducerFrequency
+	newconfig.Producer.Compression = c.Compression
+	if c.TransactionID != "" {
+		newconfig.Producer.Idempotent = true
+		newconfig.Producer.Transaction.ID = c.TransactionID
+		newconfig.Net.MaxOpenRequests = 1
+	}
 	// consumer
 	newconfig.Consumer.Offsets.Initial = c.Initial
 	newconfig.ChannelBufferSize = c.ProducerBufferSize
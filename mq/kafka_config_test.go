@@ -34,3 +34,19 @@ func TestParseKafkaConfig(t *testing.T) {
 	}
 	assert.Equal(t, cfg, exceptconfig)
 }
+
+func TestParseKafkaConfigCompression(t *testing.T) {
+	cfg, err := ParseKafkaConfig(map[string]string{
+		"compression":     "zstd",
+		"claimcheckbytes": "1048576",
+		"blobpath":        "/tmp/blob",
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, cfg.Compression, sarama.CompressionZSTD)
+	assert.Equal(t, cfg.ClaimCheckBytes, 1048576)
+	assert.Equal(t, cfg.BlobPath, "/tmp/blob")
+	assert.Equal(t, cfg.GenConfig().Producer.Compression, sarama.CompressionZSTD)
+
+	_, err = ParseKafkaConfig(map[string]string{"compression": "unknown"})
+	assert.NotEqual(t, err, nil)
+}
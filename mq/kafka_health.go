@@ -0,0 +1,202 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/pkg/errors"
+)
+
+// newClusterAdmin 创建kafka管理客户端, 方便用于mock
+var newClusterAdmin = sarama.NewClusterAdmin
+
+// fatalProducerErrors 生产者遇到这些错误后需要重建
+var fatalProducerErrors = []error{
+	sarama.ErrOutOfBrokers,
+	sarama.ErrClosedClient,
+	sarama.ErrNotConnected,
+	sarama.ErrShuttingDown,
+	sarama.ErrProducerFenced,
+}
+
+// HealthStatus kafka 健康状态
+type HealthStatus struct {
+	Healthy       bool
+	Degraded      bool // 可用但消费者组正在重平衡, 暂时不消费
+	CheckTime     time.Time
+	Brokers       int      // 可用broker数量
+	MissingTopics []string // 不存在的topic
+	GroupState    string   // 消费者组状态
+	Err           error
+}
+
+// 消费者组状态, 见 kafka GroupState
+const (
+	groupStateDead                = "Dead"
+	groupStatePreparingRebalance  = "PreparingRebalance"
+	groupStateCompletingRebalance = "CompletingRebalance"
+)
+
+// HealthStatusFunc 健康状态回调
+type HealthStatusFunc func(status HealthStatus)
+
+// SetStatusFunc set health status callback, called after every health check
+func (mq *KafkaMessageQueue) SetStatusFunc(f HealthStatusFunc) {
+	mq.statusFunc = f
+}
+
+// HealthCheck 检查broker连通性, topic是否存在以及消费者组状态.
+// 开始消费后消费者组为 Dead 时不健康, 正在重平衡时健康但 Degraded.
+// 检查结果会同时通知给 SetStatusFunc 设置的回调.
+func (mq *KafkaMessageQueue) HealthCheck(ctx context.Context) HealthStatus {
+	done := make(chan HealthStatus, 1)
+	go func() {
+		done <- mq.checkHealth()
+	}()
+
+	var status HealthStatus
+	select {
+	case status = <-done:
+	case <-ctx.Done():
+		status = HealthStatus{
+			CheckTime: time.Now(),
+			Err:       errors.Wrap(ctx.Err(), "kafka health check"),
+		}
+	}
+	if mq.statusFunc != nil {
+		mq.statusFunc(status)
+	}
+	return status
+}
+
+// defaultHealthCheckInterval interval 不大于0时的检查周期
+const defaultHealthCheckInterval = 30 * time.Second
+
+// StartHealthCheck 按 interval 周期执行健康检查, 直到ctx结束, interval 不大于0时使用 defaultHealthCheckInterval
+func (mq *KafkaMessageQueue) StartHealthCheck(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkctx, cancel := context.WithTimeout(ctx, interval)
+				status := mq.HealthCheck(checkctx)
+				cancel()
+				if !status.Healthy {
+					mq.logger.Warn("kafka unhealthy", "error", status.Err)
+				} else if status.Degraded {
+					mq.logger.Warn("kafka degraded", "groupstate", status.GroupState)
+				}
+			}
+		}
+	}()
+}
+
+func (mq *KafkaMessageQueue) checkHealth() HealthStatus {
+	status := HealthStatus{CheckTime: time.Now()}
+
+	clusteradmin, err := newClusterAdmin(mq.hosts, mq.GenConfig())
+	if err != nil {
+		status.Err = errors.Wrap(err, "kafka connect failed")
+		return status
+	}
+	defer func() {
+		_ = clusteradmin.Close()
+	}()
+
+	brokers, _, err := clusteradmin.DescribeCluster()
+	if err != nil {
+		status.Err = errors.Wrap(err, "kafka describe cluster failed")
+		return status
+	}
+	status.Brokers = len(brokers)
+
+	topicmap, err := clusteradmin.ListTopics()
+	if err != nil {
+		status.Err = errors.Wrap(err, "kafka list topics failed")
+		return status
+	}
+	for _, topic := range mq.topics {
+		if _, ok := topicmap[topic]; !ok {
+			status.MissingTopics = append(status.MissingTopics, topic)
+		}
+	}
+	if len(status.MissingTopics) > 0 {
+		status.Err = fmt.Errorf("kafka topics not exist: %v", status.MissingTopics)
+		return status
+	}
+
+	groups, err := clusteradmin.DescribeConsumerGroups([]string{mq.config.ConsumerGroup})
+	if err != nil {
+		status.Err = errors.Wrap(err, "kafka describe consumer group failed")
+		return status
+	}
+	for _, group := range groups {
+		if group.Err != sarama.ErrNoError {
+			status.Err = errors.Wrap(group.Err, "kafka consumer group error")
+			return status
+		}
+		status.GroupState = group.State
+	}
+
+	// 消费者组不存在时状态为 Dead, 只生产不消费或还未开始消费时是正常的
+	switch status.GroupState {
+	case groupStateDead:
+		if !mq.consuming.Load() {
+			break
+		}
+		// 消费者组已被删除或元数据已过期
+		status.Err = fmt.Errorf("kafka consumer group '%s' is dead", mq.config.ConsumerGroup)
+		return status
+	case groupStatePreparingRebalance, groupStateCompletingRebalance:
+		status.Degraded = true
+	}
+	status.Healthy = true
+	return status
+}
+
+// recoverProducer 生产者遇到致命错误时关闭并丢弃, 下次发送时重新创建
+func (mq *KafkaMessageQueue) recoverProducer(producer sarama.SyncProducer, results []TopicSendResult) {
+	fatal := producer.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0
+	for _, result := range results {
+		if isFatalProducerError(result.Err) {
+			fatal = true
+			break
+		}
+	}
+	if !fatal {
+		return
+	}
+
+	mq.producerMutex.Lock()
+	defer mq.producerMutex.Unlock()
+	if mq.producer != producer {
+		// 已经被其他goroutine重建
+		return
+	}
+	mq.producer = nil
+	mq.logger.Warn("kafka producer fatal error, will be recreated")
+	if err := producer.Close(); err != nil {
+		mq.logger.Error("kafka close producer failed", "error", err)
+	}
+}
+
+func isFatalProducerError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, fatalerr := range fatalProducerErrors {
+		if errors.Is(err, fatalerr) {
+			return true
+		}
+	}
+	return false
+}
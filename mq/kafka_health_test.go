@@ -0,0 +1,115 @@
+package mq
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/mmtbak/dsnparser"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// mockClusterAdmin 模拟kafka管理客户端
+type mockClusterAdmin struct {
+	sarama.ClusterAdmin
+	topics     map[string]sarama.TopicDetail
+	groupState string
+}
+
+func (admin *mockClusterAdmin) DescribeCluster() ([]*sarama.Broker, int32, error) {
+	return []*sarama.Broker{sarama.NewBroker("localhost:9092")}, 0, nil
+}
+
+func (admin *mockClusterAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	return admin.topics, nil
+}
+
+func (admin *mockClusterAdmin) DescribeConsumerGroups(groups []string) ([]*sarama.GroupDescription, error) {
+	return []*sarama.GroupDescription{{GroupId: groups[0], State: admin.groupState}}, nil
+}
+
+func (admin *mockClusterAdmin) Close() error {
+	return nil
+}
+
+func TestKafkaHealthCheck(t *testing.T) {
+	admin := &mockClusterAdmin{
+		topics:     map[string]sarama.TopicDetail{"topic-a": {}},
+		groupState: "Stable",
+	}
+	newClusterAdmin = func([]string, *sarama.Config) (sarama.ClusterAdmin, error) {
+		return admin, nil
+	}
+	defer func() { newClusterAdmin = sarama.NewClusterAdmin }()
+
+	var notified []HealthStatus
+	kafkamq := &KafkaMessageQueue{
+		topics: []string{"topic-a", "topic-b"},
+		config: NewDefaultKafkaConfig(),
+		dsn:    dsnparser.Parse("kafka://localhost:9092/?topics=topic-a,topic-b"),
+		hosts:  []string{"localhost:9092"},
+		logger: slog.Default(),
+	}
+	kafkamq.SetStatusFunc(func(status HealthStatus) {
+		notified = append(notified, status)
+	})
+
+	status := kafkamq.HealthCheck(context.Background())
+	assert.Equal(t, status.Healthy, false)
+	assert.Equal(t, status.Brokers, 1)
+	assert.Equal(t, status.MissingTopics, []string{"topic-b"})
+
+	admin.topics["topic-b"] = sarama.TopicDetail{}
+	status = kafkamq.HealthCheck(context.Background())
+	assert.Equal(t, status.Healthy, true)
+	assert.Equal(t, status.Err, nil)
+	assert.Equal(t, status.GroupState, "Stable")
+	assert.Equal(t, status.Degraded, false)
+	assert.Equal(t, len(notified), 2)
+
+	// 重平衡期间健康但降级
+	admin.groupState = "PreparingRebalance"
+	status = kafkamq.HealthCheck(context.Background())
+	assert.Equal(t, status.Healthy, true)
+	assert.Equal(t, status.Degraded, true)
+	admin.groupState = "CompletingRebalance"
+	status = kafkamq.HealthCheck(context.Background())
+	assert.Equal(t, status.Degraded, true)
+
+	// 只生产不消费时消费者组不存在, 状态为 Dead
+	admin.groupState = "Dead"
+	status = kafkamq.HealthCheck(context.Background())
+	assert.Equal(t, status.Healthy, true)
+	assert.Equal(t, status.GroupState, "Dead")
+
+	// 开始消费后消费者组 Dead 为不健康
+	kafkamq.consuming.Store(true)
+	status = kafkamq.HealthCheck(context.Background())
+	assert.Equal(t, status.Healthy, false)
+	assert.NotEqual(t, status.Err, nil)
+}
+
+func TestKafkaStartHealthCheckDefaultInterval(t *testing.T) {
+	kafkamq := &KafkaMessageQueue{logger: slog.Default()}
+	ctx, cancel := context.WithCancel(context.Background())
+	kafkamq.StartHealthCheck(ctx, 0)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+}
+
+func TestKafkaRecoverProducer(t *testing.T) {
+	mockproducer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	mockproducer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	kafkamq := &KafkaMessageQueue{
+		producer: mockproducer,
+		topics:   []string{"topic-a"},
+		logger:   slog.Default(),
+	}
+	err := kafkamq.SendMessage([]byte("message content"))
+	assert.Equal(t, err, sarama.ErrOutOfBrokers)
+	// 致命错误后丢弃producer, 下次发送重新创建
+	assert.Equal(t, kafkamq.producer, nil)
+}
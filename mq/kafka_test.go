@@ -1,6 +1,8 @@
 package mq
 
 import (
+	"context"
+	"errors"
 	"log"
 	"log/slog"
 	"os"
@@ -60,3 +62,119 @@ func TestKafkaSendMessage(t *testing.T) {
 	err := kafkamq.SendMessage(msg)
 	assert.Equal(t, err, nil)
 }
+
+// mockConsumerGroupSession 模拟消费者会话
+type mockConsumerGroupSession struct {
+	claims map[string][]int32
+}
+
+func (s *mockConsumerGroupSession) Claims() map[string][]int32 { return s.claims }
+func (s *mockConsumerGroupSession) MemberID() string           { return "member-1" }
+func (s *mockConsumerGroupSession) GenerationID() int32        { return 1 }
+func (s *mockConsumerGroupSession) MarkOffset(string, int32, int64, string) {
+}
+func (s *mockConsumerGroupSession) Commit() {}
+func (s *mockConsumerGroupSession) ResetOffset(string, int32, int64, string) {
+}
+func (s *mockConsumerGroupSession) MarkMessage(*sarama.ConsumerMessage, string) {}
+func (s *mockConsumerGroupSession) Context() context.Context                    { return context.Background() }
+
+func TestKafkaRebalanceCallback(t *testing.T) {
+	claims := map[string][]int32{"my-event-topic": {0, 1}}
+	var assigned, revoked map[string][]int32
+	kafkamq := &KafkaMessageQueue{
+		topics: []string{"my-event-topic"},
+		logger: slog.Default(),
+	}
+	kafkamq.SetConsumerOption(NewKafkaConsumerOption().
+		WithOnAssigned(func(partitions map[string][]int32) error {
+			assigned = partitions
+			return nil
+		}).
+		WithOnRevoked(func(partitions map[string][]int32) error {
+			revoked = partitions
+			return errors.New("flush failed")
+		}))
+	handler := &kafkaConsumerGroupHandler{queue: kafkamq}
+	session := &mockConsumerGroupSession{claims: claims}
+
+	err := handler.Setup(session)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, assigned, claims)
+	assert.Equal(t, revoked == nil, true)
+
+	err = handler.Cleanup(session)
+	assert.Equal(t, err != nil, true)
+	assert.Equal(t, revoked, claims)
+}
+
+func TestKafkaFanoutMessage(t *testing.T) {
+	topics := []string{"topic-a", "topic-b", "topic-c"}
+	mockproducer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	mockproducer.ExpectSendMessageAndSucceed()
+	mockproducer.ExpectSendMessageAndFail(sarama.ErrMessageSizeTooLarge)
+	mockproducer.ExpectSendMessageAndSucceed()
+
+	kafkamq := &KafkaMessageQueue{
+		producer: mockproducer,
+		topics:   topics,
+		logger:   slog.Default(),
+	}
+	results, err := kafkamq.FanoutMessage([]byte("message content"))
+	assert.Equal(t, err != nil, true)
+	assert.Equal(t, len(results), 3)
+	assert.Equal(t, results[0].Err, nil)
+	assert.Equal(t, results[1].Topic, "topic-b")
+	assert.Equal(t, results[1].Err, sarama.ErrMessageSizeTooLarge)
+	assert.Equal(t, results[2].Err, nil)
+
+	// 指定topic发送
+	mockproducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != "topic-x" {
+			return errors.New("unexpected topic " + msg.Topic)
+		}
+		return nil
+	})
+	err = kafkamq.SendMessage([]byte("message content"), NewSendMsgOption().WithTopic("topic-x"))
+	assert.Equal(t, err, nil)
+}
+
+func TestKafkaSendMessageInTransaction(t *testing.T) {
+	topics := []string{"topic-a", "topic-b"}
+	kafkaconfig := NewDefaultKafkaConfig()
+	kafkaconfig.TransactionID = "my-transaction"
+	mockproducer := mocks.NewSyncProducer(t, kafkaconfig.GenConfig())
+	mockproducer.ExpectSendMessageAndSucceed()
+	mockproducer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+
+	kafkamq := &KafkaMessageQueue{
+		producer: mockproducer,
+		topics:   topics,
+		config:   kafkaconfig,
+		logger:   slog.Default(),
+	}
+	results, err := kafkamq.FanoutMessage([]byte("message content"))
+	assert.Equal(t, err, sarama.ErrOutOfBrokers)
+	assert.Equal(t, len(results), 2)
+	// 事务回滚, 所有topic都失败
+	assert.Equal(t, results[0].Err, sarama.ErrOutOfBrokers)
+	assert.Equal(t, mockproducer.TxnStatus(), sarama.ProducerTxnFlagReady)
+}
+
+func TestKafkaSendMessageSingleTopicInTransaction(t *testing.T) {
+	kafkaconfig := NewDefaultKafkaConfig()
+	kafkaconfig.TransactionID = "tx"
+	mockproducer := mocks.NewSyncProducer(t, kafkaconfig.GenConfig())
+	mockproducer.ExpectSendMessageAndSucceed()
+
+	kafkamq := &KafkaMessageQueue{
+		producer: mockproducer,
+		topics:   []string{"topic-a"},
+		config:   kafkaconfig,
+		logger:   slog.Default(),
+	}
+	err := kafkamq.SendMessage([]byte("message content"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, mockproducer.TxnStatus(), sarama.ProducerTxnFlagReady)
+	assert.Equal(t, mockproducer.Close(), nil)
+}
@@ -3,11 +3,15 @@ package mq
 import (
 	"context"
 	"time"
+
+	"github.com/IBM/sarama"
 )
 
 type SendMsgOption struct {
 	Sendtime time.Time
 	Key      string
+	// Topics 指定发送的topic, 为空时发送到队列配置的全部topic
+	Topics []string
 }
 
 func NewSendMsgOption() *SendMsgOption {
@@ -27,6 +31,11 @@ func (opt *SendMsgOption) WithKey(key string) *SendMsgOption {
 	return opt
 }
 
+func (opt *SendMsgOption) WithTopic(topics ...string) *SendMsgOption {
+	opt.Topics = append(opt.Topics, topics...)
+	return opt
+}
+
 type ConsumeMsgOption struct {
 	Poolsize int
 	Ctx      context.Context
@@ -56,3 +65,39 @@ func MergeConsumeMsgOptions(opts []ConsumeMsgOption) ConsumeMsgOption {
 	}
 	return opts[0]
 }
+
+// RebalanceFunc 分区重平衡回调, partitions 为 topic -> partition 列表.
+type RebalanceFunc func(partitions map[string][]int32) error
+
+// ClaimCheckErrorFunc claim check 消息体不存在时的回调.
+type ClaimCheckErrorFunc func(message *sarama.ConsumerMessage, err error)
+
+// KafkaConsumerOption kafka 消费者选项.
+type KafkaConsumerOption struct {
+	// OnAssigned 新的会话分配到分区后, 开始消费之前调用
+	OnAssigned RebalanceFunc
+	// OnRevoked 会话结束, 所有分区停止消费后, 提交offset之前调用
+	OnRevoked RebalanceFunc
+	// OnClaimCheckError claim check 消息体已不存在(ErrBlobNotFound)时调用, 调用后消息被标记为已消费并跳过,
+	// 可以在回调中将消息转存到死信队列. 其它读取错误不会调用, 消息会在下次会话重新消费
+	OnClaimCheckError ClaimCheckErrorFunc
+}
+
+func NewKafkaConsumerOption() *KafkaConsumerOption {
+	return &KafkaConsumerOption{}
+}
+
+func (opt *KafkaConsumerOption) WithOnAssigned(f RebalanceFunc) *KafkaConsumerOption {
+	opt.OnAssigned = f
+	return opt
+}
+
+func (opt *KafkaConsumerOption) WithOnRevoked(f RebalanceFunc) *KafkaConsumerOption {
+	opt.OnRevoked = f
+	return opt
+}
+
+func (opt *KafkaConsumerOption) WithOnClaimCheckError(f ClaimCheckErrorFunc) *KafkaConsumerOption {
+	opt.OnClaimCheckError = f
+	return opt
+}
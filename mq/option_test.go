@@ -16,3 +16,8 @@ func TestSendMsgOption(t *testing.T) {
 	}
 	assert.Equal(t, opt, exceptoption)
 }
+
+func TestSendMsgOptionWithTopic(t *testing.T) {
+	opt := NewSendMsgOption().WithTopic("topic-a").WithTopic("topic-b", "topic-c")
+	assert.Equal(t, opt.Topics, []string{"topic-a", "topic-b", "topic-c"})
+}
@@ -0,0 +1,100 @@
+package mq
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// mockSchemaRegistry 本地模拟的 schema registry
+type mockSchemaRegistry struct {
+	mutex    sync.Mutex
+	schemas  []Schema
+	subjects map[string][]int
+	requests int
+	// incompatible 兼容性检查返回不兼容
+	incompatible bool
+}
+
+func (r *mockSchemaRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests++
+	path := req.URL.Path
+	switch {
+	case req.Method == http.MethodPost && strings.HasPrefix(path, "/compatibility/subjects/"):
+		subject := strings.Split(strings.TrimPrefix(path, "/compatibility/subjects/"), "/")[0]
+		if len(r.subjects[subject]) == 0 {
+			http.Error(w, `{"error_code":40401}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]bool{"is_compatible": !r.incompatible})
+	case req.Method == http.MethodPost && strings.HasPrefix(path, "/subjects/"):
+		subject := strings.Split(strings.TrimPrefix(path, "/subjects/"), "/")[0]
+		var schema Schema
+		_ = json.NewDecoder(req.Body).Decode(&schema)
+		schema.ID = len(r.schemas) + 1
+		r.schemas = append(r.schemas, schema)
+		r.subjects[subject] = append(r.subjects[subject], schema.ID)
+		_ = json.NewEncoder(w).Encode(map[string]int{"id": schema.ID})
+	case req.Method == http.MethodGet && strings.HasPrefix(path, "/schemas/ids/"):
+		var id int
+		_ = json.Unmarshal([]byte(strings.TrimPrefix(path, "/schemas/ids/")), &id)
+		if id <= 0 || id > len(r.schemas) {
+			http.Error(w, `{"error_code":40403}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(r.schemas[id-1])
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func TestSchemaRegistryCodec(t *testing.T) {
+	registry := &mockSchemaRegistry{subjects: map[string][]int{}}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	client, err := NewSchemaRegistryClient(server.URL)
+	assert.Equal(t, err, nil)
+	avroschema := Schema{Schema: `{"type":"string"}`, SchemaType: SchemaTypeAvro}
+	codec := NewSchemaRegistryCodec(client, "my-event-value", avroschema)
+
+	data, err := codec.Encode([]byte("payload"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, data[:5], []byte{0, 0, 0, 0, 1})
+	// 第二次编码使用缓存
+	_, err = codec.Encode([]byte("payload"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, registry.requests, 2)
+
+	schema, payload, err := codec.Decode(data)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, schema.ID, 1)
+	assert.Equal(t, string(payload), "payload")
+
+	// protobuf 携带 message indexes
+	protoschema := Schema{Schema: `syntax = "proto3"; message A {} message B {}`, SchemaType: SchemaTypeProtobuf}
+	protocodec := NewSchemaRegistryCodec(client, "my-proto-value", protoschema)
+	protocodec.MessageIndexes = []int{1}
+	data, err = protocodec.Encode([]byte("proto-payload"))
+	assert.Equal(t, err, nil)
+	schema, payload, err = DecodeSchemaMessage(client, data)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, schema.SchemaType, SchemaTypeProtobuf)
+	assert.Equal(t, string(payload), "proto-payload")
+
+	// 不兼容的schema
+	registry.incompatible = true
+	newcodec := NewSchemaRegistryCodec(client, "my-event-value", Schema{Schema: `{"type":"int"}`})
+	_, err = newcodec.Encode([]byte("payload"))
+	assert.NotEqual(t, err, nil)
+
+	_, _, err = codec.Decode([]byte("invalid"))
+	assert.NotEqual(t, err, nil)
+}
@@ -0,0 +1,243 @@
+// Package rdbcache 连接 rdb.DBClient 和 cache.Cache, 提供按主键查询的 cache-aside 能力,
+// 并通过 gorm callback 在 create/update/delete 之后自动失效相关的缓存.
+package rdbcache
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/mmtbak/microlibrary/cache"
+	"github.com/mmtbak/microlibrary/rdb"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	defaultttl    = 10 * time.Minute
+	callbackname  = "rdbcache:invalidate"
+	committx      = "gorm:commit_or_rollback_transaction"
+	defaultprefix = "rdbcache:"
+)
+
+// ModelOption 每个 model 的缓存配置.
+type ModelOption struct {
+	// TTL 缓存时间, 为 0 时使用 CachedDB 的默认值
+	TTL time.Duration
+}
+
+// model 已注册的 model.
+type model struct {
+	option  ModelOption
+	primary *schema.Field
+}
+
+// CachedDB 按主键查询时读穿缓存, 写入时失效缓存.
+// 缓存 key 为 prefix + 表名 + ":" + 主键, 同时打上表名的 tag;
+// 写入的 model 带有主键时只删除对应的 key, 否则(例如按条件批量更新)失效整张表的缓存.
+// callback 在 gorm 默认事务提交之后触发, 避免提交前的并发读回填旧值; 回滚时不失效.
+// 在 db.Transaction 等显式事务中, callback 在外层事务提交前触发, 需要在提交后调用 Invalidate 或 InvalidateModel.
+type CachedDB struct {
+	client *rdb.DBClient
+	cache  *cache.TagCache
+	codec  cache.Codec
+	ttl    time.Duration
+	prefix string
+	logger *slog.Logger
+
+	mutex  sync.RWMutex
+	models map[string]model
+}
+
+// New new cached db, 默认使用 JSONCodec, TTL 10 分钟.
+func New(client *rdb.DBClient, c cache.Cache) *CachedDB {
+	return &CachedDB{
+		client: client,
+		cache:  cache.NewTagCache(c),
+		codec:  cache.JSONCodec{},
+		ttl:    defaultttl,
+		prefix: defaultprefix,
+		logger: slog.Default(),
+		models: make(map[string]model),
+	}
+}
+
+// WithCodec set value codec.
+func (c *CachedDB) WithCodec(codec cache.Codec) *CachedDB {
+	c.codec = codec
+	return c
+}
+
+// WithTTL set default ttl.
+func (c *CachedDB) WithTTL(ttl time.Duration) *CachedDB {
+	c.ttl = ttl
+	return c
+}
+
+// WithPrefix set cache key prefix, 默认 "rdbcache:".
+func (c *CachedDB) WithPrefix(prefix string) *CachedDB {
+	c.prefix = prefix
+	return c
+}
+
+// SetLogger set logger.
+func (c *CachedDB) SetLogger(l *slog.Logger) {
+	c.logger = l
+}
+
+// Register 注册需要缓存的 model, model 必须有且只有一个主键.
+func (c *CachedDB) Register(value any, option ModelOption) error {
+	stmt := &gorm.Statement{DB: c.client.DB()}
+	if err := stmt.Parse(value); err != nil {
+		return err
+	}
+	if len(stmt.Schema.PrimaryFields) != 1 {
+		return fmt.Errorf("rdbcache: model '%s' must have exactly one primary key", stmt.Schema.Name)
+	}
+	if option.TTL == 0 {
+		option.TTL = c.ttl
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.models[stmt.Schema.Table] = model{option: option, primary: stmt.Schema.PrioritizedPrimaryField}
+	return nil
+}
+
+// RegisterCallbacks 在 client 的 create/update/delete 提交事务之后注册失效缓存的 callback.
+func (c *CachedDB) RegisterCallbacks() error {
+	callback := c.client.DB().Callback()
+	if err := callback.Create().After(committx).Register(callbackname, c.invalidate); err != nil {
+		return err
+	}
+	if err := callback.Update().After(committx).Register(callbackname, c.invalidate); err != nil {
+		return err
+	}
+	return callback.Delete().After(committx).Register(callbackname, c.invalidate)
+}
+
+// Find 按主键查询, 命中缓存时不查询数据库, model 必须已经注册.
+func Find[T any](ctx context.Context, c *CachedDB, id any) (*T, error) {
+	var value T
+	stmt := &gorm.Statement{DB: c.client.DB()}
+	if err := stmt.Parse(&value); err != nil {
+		return nil, err
+	}
+	m, ok := c.model(stmt.Schema.Table)
+	if !ok {
+		return nil, fmt.Errorf("rdbcache: model '%s' not registered", stmt.Schema.Name)
+	}
+	key := c.key(stmt.Schema.Table, id)
+	data, err := c.cache.Get(key)
+	if err == nil {
+		if err = c.codec.Unmarshal(data, &value); err == nil {
+			return &value, nil
+		}
+		c.logger.Warn("rdbcache: decode cache failed", "key", string(key), "error", err)
+	} else if !cache.IsErrNotFound(err) {
+		c.logger.Warn("rdbcache: get cache failed", "key", string(key), "error", err)
+	}
+
+	err = c.client.Session().WithContext(ctx).Where(clause.Eq{
+		Column: clause.Column{Table: clause.CurrentTable, Name: m.primary.DBName},
+		Value:  id,
+	}).Take(&value).Error
+	if err != nil {
+		return nil, err
+	}
+	if data, err = c.codec.Marshal(&value); err == nil {
+		err = c.cache.SetWithTags(key, data, m.option.TTL, c.tag(stmt.Schema.Table))
+	}
+	if err != nil {
+		c.logger.Warn("rdbcache: set cache failed", "key", string(key), "error", err)
+	}
+	return &value, nil
+}
+
+// Invalidate 删除 model 指定主键的缓存.
+func (c *CachedDB) Invalidate(value any, id any) error {
+	stmt := &gorm.Statement{DB: c.client.DB()}
+	if err := stmt.Parse(value); err != nil {
+		return err
+	}
+	c.cache.Delete(c.key(stmt.Schema.Table, id))
+	return nil
+}
+
+// InvalidateModel 失效 model 的所有缓存.
+func (c *CachedDB) InvalidateModel(value any) error {
+	stmt := &gorm.Statement{DB: c.client.DB()}
+	if err := stmt.Parse(value); err != nil {
+		return err
+	}
+	return c.cache.InvalidateTag(c.tag(stmt.Schema.Table))
+}
+
+// invalidate gorm callback.
+func (c *CachedDB) invalidate(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	table := db.Statement.Table
+	m, ok := c.model(table)
+	if !ok {
+		return
+	}
+	// db.Table(...) 不带 model 时无法取得主键, 失效整张表
+	if db.Statement.Schema == nil {
+		c.invalidateTable(table)
+		return
+	}
+	var keys [][]byte
+	precise := true
+	collect := func(rv reflect.Value) {
+		rv = reflect.Indirect(rv)
+		if rv.Kind() != reflect.Struct {
+			precise = false
+			return
+		}
+		id, zero := m.primary.ValueOf(db.Statement.Context, rv)
+		if zero {
+			precise = false
+			return
+		}
+		keys = append(keys, c.key(table, id))
+	}
+	switch rv := db.Statement.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := range rv.Len() {
+			collect(rv.Index(i))
+		}
+	default:
+		collect(rv)
+	}
+	if !precise {
+		c.invalidateTable(table)
+		return
+	}
+	cache.MDelete(c.cache, keys)
+}
+
+func (c *CachedDB) invalidateTable(table string) {
+	if err := c.cache.InvalidateTag(c.tag(table)); err != nil {
+		c.logger.Error("rdbcache: invalidate table failed", "table", table, "error", err)
+	}
+}
+
+func (c *CachedDB) model(table string) (model, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	m, ok := c.models[table]
+	return m, ok
+}
+
+func (c *CachedDB) key(table string, id any) []byte {
+	return fmt.Appendf(nil, "%s%s:%v", c.prefix, table, id)
+}
+
+func (c *CachedDB) tag(table string) string {
+	return c.prefix + table
+}
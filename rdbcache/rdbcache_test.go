@@ -0,0 +1,161 @@
+package rdbcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mmtbak/microlibrary/cache"
+	"github.com/mmtbak/microlibrary/rdb"
+	"gopkg.in/go-playground/assert.v1"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type User struct {
+	ID   int `gorm:"primaryKey"`
+	Name string
+}
+
+type Order struct {
+	ID     int `gorm:"primaryKey"`
+	Amount int
+}
+
+func TestCachedDB(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Equal(t, err, nil)
+	mock.ExpectQuery("SELECT VERSION()").WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("5.7.30"))
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{Conn: db}), &gorm.Config{})
+	assert.Equal(t, err, nil)
+	client := (&rdb.DBClient{}).WithDB(gormDB)
+	backend, err := cache.NewMemoryCacheWithParam(cache.PolicyLRU, 100, 0, 1)
+	assert.Equal(t, err, nil)
+
+	c := New(client, backend)
+	assert.Equal(t, c.Register(&User{}, ModelOption{}), nil)
+	assert.Equal(t, c.RegisterCallbacks(), nil)
+	ctx := context.Background()
+	expectSelect := func(name string) {
+		mock.ExpectQuery("SELECT \\* FROM `users` WHERE `users`.`id` = \\? LIMIT 1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, name))
+	}
+
+	// 第二次查询命中缓存
+	expectSelect("alice")
+	user, err := Find[User](ctx, c, 1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Name, "alice")
+	user, err = Find[User](ctx, c, 1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Name, "alice")
+	assert.Equal(t, mock.ExpectationsWereMet(), nil)
+
+	// 按主键更新后只失效对应的key
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `users` SET `name`=\\? WHERE `id` = \\?").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.Equal(t, gormDB.Model(&User{ID: 1}).Update("name", "bob").Error, nil)
+	expectSelect("bob")
+	user, err = Find[User](ctx, c, 1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Name, "bob")
+
+	// 按条件删除时失效整张表
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `users` WHERE name = \\?").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.Equal(t, gormDB.Where("name = ?", "bob").Delete(&User{}).Error, nil)
+	expectSelect("carol")
+	user, err = Find[User](ctx, c, 1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Name, "carol")
+
+	// 只指定表名时失效整张表
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `users` SET `name`=\\? WHERE name = \\?").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.Equal(t, gormDB.Table("users").Where("name = ?", "carol").Updates(map[string]any{"name": "carl"}).Error, nil)
+	expectSelect("carl")
+	user, err = Find[User](ctx, c, 1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Name, "carl")
+
+	// 不存在的记录不缓存
+	mock.ExpectQuery("SELECT \\* FROM `users`").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	_, err = Find[User](ctx, c, 2)
+	assert.Equal(t, rdb.IsErrRecordNotFound(err), true)
+
+	// 未注册的 model 不缓存, callback 也不处理
+	_, err = Find[Order](ctx, c, 1)
+	assert.NotEqual(t, err, nil)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `orders`").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	assert.Equal(t, gormDB.Create(&Order{Amount: 10}).Error, nil)
+
+	// Invalidate 手动失效
+	assert.Equal(t, c.Invalidate(&User{}, 1), nil)
+	expectSelect("dave")
+	user, err = Find[User](ctx, c, 1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Name, "dave")
+	assert.Equal(t, c.InvalidateModel(&User{}), nil)
+	expectSelect("erin")
+	user, err = Find[User](ctx, c, 1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Name, "erin")
+
+	assert.Equal(t, mock.ExpectationsWereMet(), nil)
+}
+
+// hookCache 删除key时调用 onDelete.
+type hookCache struct {
+	cache.Cache
+	onDelete func()
+}
+
+func (c *hookCache) Delete(key []byte) bool {
+	c.onDelete()
+	return c.Cache.Delete(key)
+}
+
+func TestCachedDBInvalidateAfterCommit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Equal(t, err, nil)
+	mock.ExpectQuery("SELECT VERSION()").WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("5.7.30"))
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{Conn: db}), &gorm.Config{})
+	assert.Equal(t, err, nil)
+	client := (&rdb.DBClient{}).WithDB(gormDB)
+	memory, err := cache.NewMemoryCacheWithParam(cache.PolicyLRU, 100, 0, 1)
+	assert.Equal(t, err, nil)
+	// 删除缓存时事务必须已经提交
+	var deletes int
+	backend := &hookCache{Cache: memory, onDelete: func() {
+		deletes++
+		assert.Equal(t, mock.ExpectationsWereMet(), nil)
+	}}
+
+	c := New(client, backend)
+	assert.Equal(t, c.Register(&User{}, ModelOption{}), nil)
+	assert.Equal(t, c.RegisterCallbacks(), nil)
+	ctx := context.Background()
+	mock.ExpectQuery("SELECT \\* FROM `users`").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "alice"))
+	_, err = Find[User](ctx, c, 1)
+	assert.Equal(t, err, nil)
+
+	// 提交失败时不失效
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `users`").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit().WillReturnError(errors.New("commit failed"))
+	assert.NotEqual(t, gormDB.Model(&User{ID: 1}).Update("name", "bob").Error, nil)
+	assert.Equal(t, deletes, 0)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `users`").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.Equal(t, gormDB.Model(&User{ID: 1}).Update("name", "bob").Error, nil)
+	assert.Equal(t, deletes, 1)
+	assert.Equal(t, mock.ExpectationsWereMet(), nil)
+}